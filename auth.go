@@ -0,0 +1,92 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// AuthProvider resolves who is calling Load, so Client can filter out fields the caller's roles
+// don't grant access to. UserFor is called once per Load, not once per field.
+type AuthProvider interface {
+	UserFor(ctx context.Context) (user string, roles []string, err error)
+}
+
+// PartialLoadError is returned by Load when an AuthProvider is configured and one or more fields
+// tagged with an "acl" option were skipped because none of the caller's roles matched. The fields
+// that could be loaded are still populated; Skipped lists the etcd paths that were not.
+type PartialLoadError struct {
+	Skipped []string
+}
+
+func (e PartialLoadError) Error() string {
+	return fmt.Sprintf("etcetera: skipped %d field(s) the caller isn't authorized to read: %s",
+		len(e.Skipped), strings.Join(e.Skipped, ", "))
+}
+
+// WithAuth opts a Client into ACL enforcement during Load: fields tagged with an "acl=role" option
+// are only populated when provider reports the caller holding that role, and Load reports a
+// PartialLoadError listing whichever ones it skipped. It returns c so it can be chained right after
+// NewClient or NewClientWithConfig.
+func (c *Client) WithAuth(provider AuthProvider) *Client {
+	c.auth = provider
+	return c
+}
+
+// aclFilter carries a single Load call's resolved roles and the paths skipped because none of them
+// matched a field's "acl" option, threaded through fillField/fillFieldDecode so a field nested
+// inside a struct or slice is filtered the same way a top-level one is. A nil filter (no
+// AuthProvider configured) never filters anything.
+type aclFilter struct {
+	roles   []string
+	skipped []string
+}
+
+// newACLFilter resolves provider's roles once, up front, so the same role set is used to check
+// every tagged field through the rest of the Load call instead of calling provider per field.
+func newACLFilter(ctx context.Context, provider AuthProvider) (*aclFilter, error) {
+	if provider == nil {
+		return nil, nil
+	}
+
+	_, roles, err := provider.UserFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &aclFilter{roles: roles}, nil
+}
+
+// allowed reports whether acl grants access under this filter: every field is allowed when there's
+// no filter (no AuthProvider) or the field carries no "acl" option at all.
+func (f *aclFilter) allowed(acl string) bool {
+	if f == nil || len(acl) == 0 {
+		return true
+	}
+
+	for _, role := range f.roles {
+		if role == acl {
+			return true
+		}
+	}
+
+	return false
+}
+
+// skip records that path was left unpopulated because the caller lacked the role it requires.
+func (f *aclFilter) skip(path string) {
+	f.skipped = append(f.skipped, path)
+}
+
+// err returns a PartialLoadError describing every path skip recorded, or nil if none were.
+func (f *aclFilter) err() error {
+	if f == nil || len(f.skipped) == 0 {
+		return nil
+	}
+
+	return PartialLoadError{Skipped: f.skipped}
+}
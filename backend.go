@@ -0,0 +1,109 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"context"
+	"time"
+)
+
+// Node is a backend-agnostic representation of a key stored in etcd. Both the legacy go-etcd
+// (Keys API v2) backend and the context-aware KeysAPI backend translate their own response types
+// into a Node, so the reflection-driven Save/Load/Watch logic only has to know about this type.
+type Node struct {
+	Key           string
+	Value         string
+	Dir           bool
+	Nodes         []*Node
+	ModifiedIndex uint64
+
+	// Action and PrevValue are only populated by Watch; they describe what changed (set, create,
+	// update, delete or expire) and, for updates, the value the key held before the change
+	Action    string
+	PrevValue string
+}
+
+// kv abstracts the set of etcd operations used by the struct-walker (Save/Load/Watch/Delete),
+// allowing Client to work against different backend implementations (go-etcd v2, the KeysAPI
+// client, or a future clientv3 backend) without duplicating the reflection logic.
+type kv interface {
+	Get(ctx context.Context, path string, sort, recursive bool) (*Node, error)
+	Set(ctx context.Context, path, value string, ttl uint64) (*Node, error)
+	Create(ctx context.Context, path, value string, ttl uint64) (*Node, error)
+	CreateDir(ctx context.Context, path string, ttl uint64) (*Node, error)
+	CreateInOrder(ctx context.Context, path, value string, ttl uint64) (*Node, error)
+	Delete(ctx context.Context, path string, recursive bool) (*Node, error)
+	CompareAndSwap(ctx context.Context, path, value string, ttl uint64, prevValue string, prevIndex uint64) (*Node, error)
+	CompareAndDelete(ctx context.Context, path, prevValue string, prevIndex uint64) (*Node, error)
+	Watch(ctx context.Context, path string, waitIndex uint64, recursive bool, receiver chan *Node, stop chan bool) (*Node, error)
+}
+
+// txnCompare guards a single key in a txner.Txn call: the write only takes place if the key's
+// ModRevision in etcd still matches Revision.
+type txnCompare struct {
+	Path     string
+	Revision uint64
+}
+
+// txnPut is a single key/value write to make as part of a txner.Txn call.
+type txnPut struct {
+	Path  string
+	Value string
+	TTL   uint64
+}
+
+// txner is implemented by backends that can commit several key writes atomically, guarded by each
+// key's expected ModRevision. Only BackendV3 satisfies it, since etcd's v2 Keys API has no
+// multi-key transaction; Client.SaveTxn reports ErrTxnNotSupported on backends that don't. When the
+// transaction doesn't succeed, conflicted lists the paths among compares whose current ModRevision
+// no longer matched what was expected, so the caller can report exactly what changed.
+type txner interface {
+	Txn(ctx context.Context, compares []txnCompare, puts []txnPut) (succeeded bool, revision uint64, conflicted []string, err error)
+}
+
+// leaser is implemented by backends with a lease primitive independent of any single key: a TTL
+// grant shared by a group of keys and refreshed by one keep-alive loop instead of being reset key
+// by key. Only BackendV3 satisfies it; Client.KeepAlive reports ErrLeaseNotSupported on backends
+// that don't.
+type leaser interface {
+	// Grant creates a lease that lives for ttl unless renewed, and starts refreshing it until ctx is
+	// canceled. The returned channel is closed once the lease can no longer be kept alive (ctx
+	// canceled, or the lease lost/expired).
+	Grant(ctx context.Context, ttl time.Duration) (leaseID int64, keptAlive <-chan struct{}, err error)
+
+	// SetWithLease writes value to path attached to a lease previously returned by Grant, so the key
+	// expires along with the rest of that lease's group instead of carrying its own TTL.
+	SetWithLease(ctx context.Context, path, value string, leaseID int64) (*Node, error)
+}
+
+// BackendType selects which underlying etcd client implementation a Client talks to.
+type BackendType int
+
+const (
+	// BackendV2 uses the legacy github.com/coreos/go-etcd/etcd client (Keys API v2). It has no
+	// notion of context.Context, so cancellation and per-call deadlines are not honored, but
+	// Config.TLS, Username/Password and DialTimeout are still applied to it.
+	BackendV2 BackendType = iota
+
+	// BackendKeysAPI uses the context-aware github.com/coreos/etcd/client Keys API, which adds
+	// quorum reads and request cancellation via context.Context on top of the same TLS and
+	// authentication support BackendV2 has.
+	BackendKeysAPI
+
+	// BackendV3 uses go.etcd.io/etcd/client/v3, the gRPC client for etcd 3.x clusters, trading the
+	// v2 Keys API's directory tree for a flat keyspace and TTLs for leases.
+	BackendV3
+)
+
+func newBackend(cfg Config) (kv, error) {
+	switch cfg.Backend {
+	case BackendKeysAPI:
+		return newKeysAPIBackend(cfg)
+	case BackendV3:
+		return newV3Backend(cfg)
+	default:
+		return newV2BackendWithConfig(cfg)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"container/list"
+	"reflect"
+	"sync"
+)
+
+// CacheStats reports how the cache enabled by Client.WithCache has performed so far
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+// cacheEntry is what loadCache stores for a path: the decoded value fillField produced the last
+// time it ran against modifiedIndex, along with everything needed to restore info on a cache hit
+// without re-deriving it
+type cacheEntry struct {
+	path          string
+	modifiedIndex uint64
+	value         reflect.Value
+	valueStr      string
+	codec         string
+}
+
+// loadCache is an LRU cache of decoded field values keyed by etcd path, enabled by Client.WithCache.
+// It plays the same role as the object cache in Kubernetes' etcd_helper: the expensive part of
+// applying a Get response is turning its string value back into a Go value (parsing numbers,
+// rebuilding maps and slices), not the round-trip itself, so caching the decoded result keyed by the
+// ModifiedIndex it came from is enough to make repeated Load/Watch calls against an unchanged
+// configuration cheap.
+type loadCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+	stats CacheStats
+}
+
+// newLoadCache creates a loadCache holding at most size entries; size <= 0 means it never evicts on
+// its own.
+func newLoadCache(size int) *loadCache {
+	return &loadCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// get returns the entry cached for path if it is still fresh, i.e. was produced from the same
+// modifiedIndex being asked about now.
+func (c *loadCache) get(path string, modifiedIndex uint64) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[path]
+	if !ok {
+		c.stats.Misses++
+		return cacheEntry{}, false
+	}
+
+	entry := elem.Value.(cacheEntry)
+	if entry.modifiedIndex != modifiedIndex {
+		c.stats.Misses++
+		return cacheEntry{}, false
+	}
+
+	c.ll.MoveToFront(elem)
+	c.stats.Hits++
+	return entry, true
+}
+
+// set stores value (deep-copied, so later in-place mutations of the bound configuration can't
+// corrupt the cache) as the decoded result for path at modifiedIndex, evicting the least recently
+// used entry when the cache is already at its size limit.
+func (c *loadCache) set(path string, modifiedIndex uint64, value reflect.Value, valueStr, codec string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := cacheEntry{
+		path:          path,
+		modifiedIndex: modifiedIndex,
+		value:         deepCopy(value),
+		valueStr:      valueStr,
+		codec:         codec,
+	}
+
+	if elem, ok := c.items[path]; ok {
+		elem.Value = entry
+		c.ll.MoveToFront(elem)
+		return
+	}
+
+	c.items[path] = c.ll.PushFront(entry)
+
+	if c.size > 0 && c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(cacheEntry).path)
+		c.stats.Evictions++
+	}
+}
+
+// invalidate drops path's cached entry, if any, so the next Load or Watch decodes it regardless of
+// what ModifiedIndex it finds.
+func (c *loadCache) invalidate(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[path]; ok {
+		c.ll.Remove(elem)
+		delete(c.items, path)
+	}
+}
+
+func (c *loadCache) statsSnapshot() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
@@ -5,13 +5,57 @@
 package etcetera
 
 import (
+	"strings"
+
 	"github.com/coreos/go-etcd/etcd"
 )
 
 type client interface {
 	CreateDir(path string, ttl uint64) (*etcd.Response, error)
 	CreateInOrder(path, value string, ttl uint64) (*etcd.Response, error)
+	Create(path, value string, ttl uint64) (*etcd.Response, error)
 	Set(path, value string, ttl uint64) (*etcd.Response, error)
 	Get(path string, sort, recursive bool) (*etcd.Response, error)
 	Watch(path string, waitIndex uint64, recursive bool, receiver chan *etcd.Response, stop chan bool) (*etcd.Response, error)
+	Delete(path string, recursive bool) (*etcd.Response, error)
+	CompareAndSwap(path, value string, ttl uint64, prevValue string, prevIndex uint64) (*etcd.Response, error)
+	CompareAndDelete(path, prevValue string, prevIndex uint64) (*etcd.Response, error)
+
+	// Members reports each machine this client knows about along with that machine's own view of
+	// the cluster, used by Client.HealthCheck to look for disagreement between them. A real go-etcd
+	// connection pools every configured machine behind automatic failover and never exposes a
+	// single machine's own perspective, so v2Client can only report on the pool as a whole; tests
+	// exercise the interesting, disagreeing-members cases through clientMock instead.
+	Members() []MemberHealth
+}
+
+// v2Client adapts *etcd.Client to the client interface, adding the cluster-health reporting method
+// go-etcd itself has no equivalent for.
+type v2Client struct {
+	*etcd.Client
+}
+
+func newV2Client(c *etcd.Client) v2Client {
+	return v2Client{Client: c}
+}
+
+// Members reports the whole connection pool as a single member: go-etcd's Keys API v2 responses
+// carry no cluster ID, and GetCluster returns the one machine list every call in the pool shares,
+// so there is no per-machine state here to tell apart. Reachability is the one real signal
+// available, checked with a Get against the root.
+func (c v2Client) Members() []MemberHealth {
+	machines := c.GetCluster()
+
+	member := MemberHealth{
+		Endpoint: strings.Join(machines, ","),
+		Members:  machines,
+	}
+
+	if _, err := c.Get("/", false, false); err != nil {
+		member.Err = err
+	} else {
+		member.Reachable = true
+	}
+
+	return []MemberHealth{member}
 }
@@ -0,0 +1,276 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Codec marshals and unmarshals a struct field to and from the string etcd stores, letting fields
+// opt out of the built-in scalar handling via the "codec" struct tag option
+type Codec interface {
+	Marshal(field reflect.Value) (string, error)
+	Unmarshal(value string, field reflect.Value) error
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+	ipType       = reflect.TypeOf(net.IP{})
+	urlType      = reflect.TypeOf(url.URL{})
+
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// resolveCodec returns the codec that should handle field, either the one explicitly named by the
+// codec tag option, or one of the built-ins auto-detected from field's type. It returns false when
+// neither applies, meaning field should fall back to the native scalar/struct/slice/map handling.
+func (c *Client) resolveCodec(field reflect.Value, name string) (Codec, bool) {
+	if name != "" {
+		codec, ok := c.codecs[name]
+		return codec, ok
+	}
+
+	switch field.Type() {
+	case durationType:
+		return c.codecs["duration"], true
+	case timeType:
+		return c.codecs["time"], true
+	case ipType:
+		return c.codecs["ip"], true
+	case urlType:
+		return c.codecs["url"], true
+	}
+
+	if field.CanAddr() && field.Addr().Type().Implements(textMarshalerType) {
+		return c.codecs["text"], true
+	}
+
+	return nil, false
+}
+
+// RegisterCodec adds or replaces the codec registered under name, making it selectable from the
+// etcd struct tag via the codec=name option
+func (c *Client) RegisterCodec(name string, codec Codec) {
+	c.codecs[name] = codec
+}
+
+// defaultCodecs builds the set of codecs every Client starts with
+func defaultCodecs() map[string]Codec {
+	return map[string]Codec{
+		"json":     jsonCodec{},
+		"text":     textCodec{},
+		"duration": durationCodec{},
+		"time":     timeCodec{},
+		"ip":       ipCodec{},
+		"url":      urlCodec{},
+		"gob":      gobCodec{},
+		"proto":    protoCodec{},
+	}
+}
+
+// jsonCodec marshals a field through encoding/json, selected with codec=json
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(field reflect.Value) (string, error) {
+	data, err := json.Marshal(field.Interface())
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func (jsonCodec) Unmarshal(value string, field reflect.Value) error {
+	return json.Unmarshal([]byte(value), field.Addr().Interface())
+}
+
+// textCodec marshals a field through encoding.TextMarshaler/TextUnmarshaler, selected with
+// codec=text or picked up automatically from types that implement the interfaces
+type textCodec struct{}
+
+func (textCodec) Marshal(field reflect.Value) (string, error) {
+	marshaler, ok := field.Addr().Interface().(encoding.TextMarshaler)
+	if !ok {
+		return "", fmt.Errorf("etcetera: %s does not implement encoding.TextMarshaler", field.Type())
+	}
+
+	data, err := marshaler.MarshalText()
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func (textCodec) Unmarshal(value string, field reflect.Value) error {
+	unmarshaler, ok := field.Addr().Interface().(encoding.TextUnmarshaler)
+	if !ok {
+		return fmt.Errorf("etcetera: %s does not implement encoding.TextUnmarshaler", field.Type())
+	}
+
+	return unmarshaler.UnmarshalText([]byte(value))
+}
+
+// durationCodec stores a time.Duration field using its String representation (e.g. "30s"), picked
+// up automatically since the reflect.Int64 it is built on would otherwise be saved as a plain number
+type durationCodec struct{}
+
+func (durationCodec) Marshal(field reflect.Value) (string, error) {
+	return field.Interface().(time.Duration).String(), nil
+}
+
+// Unmarshal accepts anything time.ParseDuration does ("30s", "5m", ...), falling back to a bare
+// integer treated as a number of seconds
+func (durationCodec) Unmarshal(value string, field reflect.Value) error {
+	if duration, err := time.ParseDuration(value); err == nil {
+		field.Set(reflect.ValueOf(duration))
+		return nil
+	}
+
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("etcetera: %q is not a valid duration", value)
+	}
+
+	field.Set(reflect.ValueOf(time.Duration(seconds) * time.Second))
+	return nil
+}
+
+// timeCodec stores a time.Time field as RFC3339Nano, picked up automatically since the struct would
+// otherwise be (uselessly) decomposed field by field by the generic struct handling
+type timeCodec struct{}
+
+func (timeCodec) Marshal(field reflect.Value) (string, error) {
+	return field.Interface().(time.Time).Format(time.RFC3339Nano), nil
+}
+
+func (timeCodec) Unmarshal(value string, field reflect.Value) error {
+	parsed, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return err
+	}
+
+	field.Set(reflect.ValueOf(parsed))
+	return nil
+}
+
+// ipCodec stores a net.IP field using its dotted (or colon-separated) string form, picked up
+// automatically since the reflect.Slice it is built on would otherwise be saved as an in-order
+// list of bytes
+type ipCodec struct{}
+
+func (ipCodec) Marshal(field reflect.Value) (string, error) {
+	return field.Interface().(net.IP).String(), nil
+}
+
+func (ipCodec) Unmarshal(value string, field reflect.Value) error {
+	parsed := net.ParseIP(value)
+	if parsed == nil {
+		return fmt.Errorf("etcetera: %q is not a valid IP address", value)
+	}
+
+	field.Set(reflect.ValueOf(parsed))
+	return nil
+}
+
+// urlCodec stores a *url.URL field using its string form, picked up automatically since the
+// reflect.Struct it is built on would otherwise be (uselessly) decomposed field by field by the
+// generic struct handling
+type urlCodec struct{}
+
+func (urlCodec) Marshal(field reflect.Value) (string, error) {
+	return field.Addr().Interface().(*url.URL).String(), nil
+}
+
+func (urlCodec) Unmarshal(value string, field reflect.Value) error {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+
+	field.Set(reflect.ValueOf(*parsed))
+	return nil
+}
+
+// gobCodec stores a field using encoding/gob, base64-encoded since etcd values are strings,
+// selected with codec=gob. Unlike the auto-detected codecs above it has to be requested explicitly,
+// since gob works for almost any type and would otherwise shadow the built-in scalar handling
+type gobCodec struct{}
+
+func (gobCodec) Marshal(field reflect.Value) (string, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(field.Interface()); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func (gobCodec) Unmarshal(value string, field reflect.Value) error {
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return err
+	}
+
+	return gob.NewDecoder(bytes.NewReader(raw)).Decode(field.Addr().Interface())
+}
+
+// protoCodec stores a field using protobuf wire encoding, base64-encoded since etcd values are
+// strings, selected with codec=proto. The field (or a pointer to it) must implement proto.Message
+type protoCodec struct{}
+
+func (protoCodec) Marshal(field reflect.Value) (string, error) {
+	message, ok := protoMessage(field)
+	if !ok {
+		return "", fmt.Errorf("etcetera: %s does not implement proto.Message", field.Type())
+	}
+
+	data, err := proto.Marshal(message)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+func (protoCodec) Unmarshal(value string, field reflect.Value) error {
+	message, ok := protoMessage(field)
+	if !ok {
+		return fmt.Errorf("etcetera: %s does not implement proto.Message", field.Type())
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return err
+	}
+
+	return proto.Unmarshal(raw, message)
+}
+
+// protoMessage returns field (addressed, if possible) as a proto.Message, so protoCodec works
+// whether the tagged field is a value or already a pointer
+func protoMessage(field reflect.Value) (proto.Message, bool) {
+	if field.CanAddr() {
+		if message, ok := field.Addr().Interface().(proto.Message); ok {
+			return message, true
+		}
+	}
+
+	message, ok := field.Interface().(proto.Message)
+	return message, ok
+}
@@ -0,0 +1,77 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/coreos/go-etcd/etcd"
+)
+
+// DiffNodes compares two etcd.Node trees and returns a description of the first mismatch found, in
+// "at <path>: <field>: got <value>; want <value>" form, or an empty string when the trees are
+// equivalent. Children are compared by Key after sorting, so two trees built by saving a map or
+// slice in a different (but equivalent) order still compare equal; this mirrors etcd's own move to
+// deterministic, sorted listings. It is exported so downstream tests built against this package's
+// mocks can produce the same assertions this package's own tests do.
+func DiffNodes(got, want *etcd.Node) string {
+	return diffNodes(got, want, "/")
+}
+
+func diffNodes(got, want *etcd.Node, path string) string {
+	if got == nil || want == nil {
+		if got == want {
+			return ""
+		}
+
+		return fmt.Sprintf("at %s: node: got %s; want %s", path, nodeKeyOrNil(got), nodeKeyOrNil(want))
+	}
+
+	if got.Key != want.Key {
+		return fmt.Sprintf("at %s: Key: got %q; want %q", path, got.Key, want.Key)
+	}
+	if got.Value != want.Value {
+		return fmt.Sprintf("at %s: Value: got %q; want %q", path, got.Value, want.Value)
+	}
+	if got.Dir != want.Dir {
+		return fmt.Sprintf("at %s: Dir: got %v; want %v", path, got.Dir, want.Dir)
+	}
+	if got.TTL != want.TTL {
+		return fmt.Sprintf("at %s: TTL: got %d; want %d", path, got.TTL, want.TTL)
+	}
+	if len(got.Nodes) != len(want.Nodes) {
+		return fmt.Sprintf("at %s: child count: got %d; want %d", path, len(got.Nodes), len(want.Nodes))
+	}
+
+	gotSorted := sortedNodes(got.Nodes)
+	wantSorted := sortedNodes(want.Nodes)
+
+	for i := range wantSorted {
+		if diff := diffNodes(gotSorted[i], wantSorted[i], wantSorted[i].Key); diff != "" {
+			return diff
+		}
+	}
+
+	return ""
+}
+
+func nodeKeyOrNil(n *etcd.Node) string {
+	if n == nil {
+		return "<nil>"
+	}
+
+	return n.Key
+}
+
+// sortedNodes returns a copy of nodes ordered by Key, so comparing or printing a directory node
+// never depends on the order its children happened to be returned or inserted in.
+func sortedNodes(nodes etcd.Nodes) etcd.Nodes {
+	sorted := make(etcd.Nodes, len(nodes))
+	copy(sorted, nodes)
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+	return sorted
+}
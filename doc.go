@@ -48,4 +48,138 @@
 // And finally, we could have concurrency issues while updating configuration fields caused by the
 // watch service. We still need to test the possible cases, but adding a read/write lock don't
 // appears to be an elegant solution.
+//
+// Update
+//
+// Client.Events replaces the per-field watch goroutines with a single recursive watcher guarded by
+// a read/write lock, so concurrent updates to configuration fields are now safe, and errors
+// encountered while watching are delivered to the caller through the returned channel instead of
+// being silently dropped. Client.Snapshot lets callers read a consistent copy of the configuration
+// while that watcher is running.
+//
+// The struct tag also grew options: "ttl" gives a key a non-zero TTL after all (revisiting the
+// "unlimited TTL" decision above for the cases where it turns out to be needed), and "codec" picks
+// a registered Codec to marshal a field instead of the built-in scalar handling, with
+// time.Duration, time.Time, net.IP, *url.URL and encoding.TextMarshaler types picked up
+// automatically even without the option, and a bare "json" option that stores a whole struct, map
+// or slice subtree as one JSON value instead of exploding it into child keys. "gob" and "proto" are
+// also registered by default, for fields that should round-trip through encoding/gob or a
+// proto.Message instead, base64-encoded since etcd only stores strings. SaveField and SaveCAS
+// round out Client.Version with a way to act on it: they save a
+// field through CompareAndSwap instead of Save's unconditional Set, returning ErrStaleVersion when
+// someone else changed the value first. SaveTxn goes further on backends with a multi-key
+// transaction (BackendV3 today): it saves every scalar field in one all-or-nothing commit guarded
+// by each key's last seen revision, returning a ConflictError listing whichever keys changed.
+// SaveWithRetry wraps SaveTxn with a reload-and-retry loop for exactly that case.
+//
+// A third tag option, "lease", marks a field as belonging to the shared lease KeepAlive grants (on
+// the same backends) instead of carrying its own "ttl": the whole group expires together in etcd
+// the moment KeepAlive's heartbeat stops, which is what ephemeral service-registration entries
+// need instead of a fixed-length TTL.
+//
+// Client.WatchAll builds on the same recursive watcher as Events, but reports changes in terms of
+// the configuration struct instead of raw etcd paths: it calls back with the dotted Go field names
+// that changed together, and recovers on its own from a compacted revision by reloading the whole
+// configuration before resuming the watch.
+//
+// Client.LoadLayered addresses a gap in Load itself: a field absent from etcd is left at whatever
+// a Source (FileSource, EnvSource, FlagSource or DefaultsSource) set it to beforehand instead of
+// failing the load, so configuration can live partly in a file, the environment, command-line
+// flags, and partly in etcd, with etcd always taking precedence when a key is actually there.
+// FlagSource considers only flags actually set on the command line, the same way EnvSource only
+// considers environment variables that are actually present, so an unset flag never overrides a
+// lower layer with its zero value. Sources are applied in the order given to LoadLayered, each
+// overriding whatever the previous one set, so passing DefaultsSource, FileSource, EnvSource and
+// FlagSource in that order gives flags precedence over the environment, the environment over the
+// file, and the file over the defaults - etcd still overlays on top of all of them afterwards,
+// rather than being the lowest-precedence layer, since a key actually present in etcd is meant to
+// be the operative value an operator pushed there on purpose, not a default to be silently
+// shadowed by a stale flag or environment variable left over from how a process was started.
+//
+// Client.WithCache opts a Client into an LRU cache of decoded field values keyed by etcd path and
+// ModifiedIndex: when Load or Watch see the same ModifiedIndex again, the field is restored from
+// the cache instead of re-parsing node.Value, which matters most for struct, map and slice fields
+// where "re-parsing" means rebuilding the whole subtree. Events and WatchAll keep it coherent,
+// invalidating or refreshing an entry as they apply each change. CacheStats reports hits, misses
+// and evictions.
+//
+// Config.Namespace lets multiple applications share one etcd cluster: every path Load, Save,
+// SaveTxn, Events and WatchAll use is built under it instead of the etcd root, so two Clients
+// configured with different namespaces never see each other's keys.
+//
+// Client.OnExpire tracks every key Saved with a non-zero "ttl" option in a local min-heap keyed by
+// when it would expire, firing a callback (and dropping the key from the local info cache) at that
+// time without polling etcd. It is a local prediction based on the TTL last Saved with the key, not
+// a confirmation that etcd actually expired it.
+//
+// DiffNodes compares two etcd.Node trees (children sorted by Key, so order never matters) and
+// describes their first mismatch, for tests built against this package's mocks.
+//
+// Client.HealthCheck asks every machine the backend knows about for its own view of the cluster
+// and reports whether they agree on cluster ID and membership, or flags one that didn't answer at
+// all - the split-brain signals an app calling Load or Save can check before trusting a read. Only
+// BackendV2 implements it today; go-etcd's pooled, auto-failover client can only speak for the pool
+// as a whole rather than a single machine, so a real connection always reports one combined member
+// rather than one per configured endpoint.
+//
+// Client.DeleteCAS rounds out SaveField the same way CompareAndDelete rounds out CompareAndSwap: it
+// removes a single scalar field guarded by the version and value last seen, returning ErrStaleVersion
+// instead of silently deleting whatever someone else wrote in the meantime.
+//
+// A fourth tag option, "acl", names the role required to read a field during Load: Client.WithAuth
+// carries an AuthProvider that resolves the caller's roles once per Load, and a tagged field whose
+// role isn't among them is left unset instead of failing the load, with the skipped paths reported
+// back through a PartialLoadError once the rest has loaded successfully.
+//
+// Client.WithHiddenPolicy tells Load (and the refresh Watch does after a change) what to do with a
+// node whose last path component begins with "_", the convention etcd's own store uses for entries
+// hidden from a plain listing: HideHidden (the default) skips them, ShowHidden loads them alongside
+// everything else, and OnlyHidden loads only them. A fifth tag option, "hidden", marks a field the
+// same way for a path that doesn't happen to start with "_".
+//
+// SaveField and SaveCAS already guard a write with the version and value last seen for that field,
+// so neither blindly overwrites a concurrent change. Client.SaveFieldIf rounds them out for a
+// version tracked outside that local cache (read back from another process, say, or from
+// Client.Version itself): it compares only against expectedVersion, ignoring whatever value last
+// passed through this Client, and returns ErrStaleVersion the same way SaveField does when it
+// doesn't match. Client.Update builds on SaveField for the common case of that pattern - read,
+// modify, write, retry on conflict - calling a mutate function to change a field's local Go value
+// and saving it, reloading the whole configuration and trying again up to maxAttempts times
+// whenever ErrStaleVersion comes back, the same way SaveWithRetry retries SaveTxn on a
+// ConflictError.
+//
+// Client.Export walks every key under the bound prefix, rather than the configuration struct's
+// fields, and returns a Snapshot of each leaf's current value and version; Snapshot.WriteTo and
+// ReadSnapshot carry it to and from a file in the same JSON, YAML or TOML formats FileSource reads,
+// giving it the config-file export/import workflow other libraries offer on top of the struct-tag
+// model Save and Load already use. Client.Restore writes a Snapshot's entries back: on a backend
+// with a multi-key transaction (BackendV3) the whole write goes through one Txn, so either every
+// key is updated or none is, while other backends write one entry at a time and roll back whatever
+// they already wrote if a later one fails. RestoreOptions.Strict refuses to overwrite any entry
+// whose version moved on since the Snapshot was taken, aborting with the same ConflictError SaveTxn
+// returns, rather than risk clobbering a change made after the snapshot.
+//
+// Config.TLS, Username and Password now reach BackendV2 as well: NewClientWithConfig already
+// accepted them, but the default backend's underlying go-etcd client was built with etcd.NewClient
+// and never saw them, so a secured cluster only worked through BackendKeysAPI or BackendV3. They're
+// applied with the same SetTransport/SetCredentials/SetDialTimeout calls go-etcd itself exposes for
+// this, rather than asking for CAFile/CertFile/KeyFile paths alongside Config.TLS: a caller with
+// certificate files on disk builds a *tls.Config from them with crypto/tls the same way they would
+// for any other Go client.
+//
+// Client.WatchDebounced works like Watch, but instead of reloading the field and calling back for
+// every single event, it coalesces events that follow each other within a given interval into a
+// single reload and callback, run once that interval passes with no further event, delivering the
+// ModifiedIndex of the last event folded into that burst. This is the efficient way to watch a struct, slice or map field: each one spans several
+// etcd keys, so a burst of changes to different leaves (a slice rewritten element by element, say)
+// would otherwise trigger as many reloads as there were leaves that changed, each only seeing
+// whatever had been written by the time that particular event's Get ran.
+//
+// BackendV3 (see NewClientV3, NewV3ClientWithLease) already covers the ground a gRPC-based backend
+// needs to: it maps the struct tags' paths onto etcd 3.x's flat keyspace (rebuilding the Node tree
+// Save/Load/Watch expect from a prefix listing), SaveTxn commits a whole config tree through one
+// Txn instead of Save's per-key Set, SaveField/SaveCAS/DeleteCAS guard a single key with a
+// ModRevision comparison the same way, Events/WatchAll multiplex every watched field through one
+// long-lived v3 Watcher instead of one goroutine per field, and the "ttl" tag option attaches a
+// lease per key. BackendV2 remains the default (NewClient), so existing callers are unaffected.
 package etcetera
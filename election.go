@@ -0,0 +1,357 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// ErrElectionLost is returned by Campaign when key is already held by a different identity, so
+// this candidate cannot take part in the election until the current leader steps down or expires
+var ErrElectionLost = errors.New("etcetera: key is already held by another candidate")
+
+// ErrFieldNotString is returned by Client.Campaign when fieldPtr does not point to a string field,
+// since the current leader's identity is a plain etcd value with no structure of its own
+var ErrFieldNotString = errors.New("etcetera: Campaign requires a string field")
+
+// Election coordinates a single-leader campaign over a key, built on top of an existing Client
+// connection. Unlike Save/Load, it bypasses the struct-tag reflection machinery and operates
+// directly on a single etcd key, since a lease has no natural mapping to a Go struct field
+type Election struct {
+	client *Client
+}
+
+// NewElection returns an Election that campaigns using c's backend connection
+func NewElection(c *Client) *Election {
+	return &Election{client: c}
+}
+
+// Campaign tries to become (or remain) the leader for key. It creates key with identity as its
+// value, which only succeeds if no one else currently holds it. If key already holds identity
+// (for example after a process restart that lost track of its own lease), Campaign takes over the
+// renewal instead of failing. Any other value already stored at key makes Campaign return
+// ErrElectionLost. The returned Lease keeps renewing the key in the background until Resign is
+// called, the lease is lost or ctx is canceled
+func (e *Election) Campaign(ctx context.Context, key, identity string, ttl time.Duration) (*Lease, error) {
+	ttlSeconds := uint64(ttl / time.Second)
+
+	node, err := e.client.backend.Create(ctx, key, identity, ttlSeconds)
+	if err != nil {
+		if !alreadyExistsError(err) {
+			return nil, err
+		}
+
+		node, err = e.client.backend.Get(ctx, key, false, false)
+		if err != nil {
+			return nil, err
+		}
+
+		if node.Value != identity {
+			return nil, ErrElectionLost
+		}
+
+		node, err = e.client.backend.CompareAndSwap(ctx, key, identity, ttlSeconds, identity, node.ModifiedIndex)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	lease := &Lease{
+		backend:  e.client.backend,
+		key:      key,
+		identity: identity,
+		ttl:      ttl,
+		index:    node.ModifiedIndex,
+		done:     make(chan struct{}),
+	}
+
+	go lease.renew(ctx)
+	return lease, nil
+}
+
+// Lease represents a campaign won (or taken over) by Campaign. It keeps itself alive with a
+// background renewal goroutine for as long as it is held
+type Lease struct {
+	backend  kv
+	key      string
+	identity string
+	ttl      time.Duration
+
+	mu    sync.Mutex
+	index uint64
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// renew extends the lease with CompareAndSwap whenever the remaining TTL drops below half of its
+// total duration, stopping (and closing Done) the moment a renewal is rejected or ctx is canceled
+func (l *Lease) renew(ctx context.Context) {
+	ticker := time.NewTicker(l.ttl / 2)
+	defer ticker.Stop()
+
+	ttlSeconds := uint64(l.ttl / time.Second)
+
+	for {
+		select {
+		case <-ticker.C:
+			l.mu.Lock()
+			index := l.index
+			l.mu.Unlock()
+
+			node, err := l.backend.CompareAndSwap(ctx, l.key, l.identity, ttlSeconds, l.identity, index)
+			if err != nil {
+				l.markLost()
+				return
+			}
+
+			l.mu.Lock()
+			l.index = node.ModifiedIndex
+			l.mu.Unlock()
+
+		case <-ctx.Done():
+			l.markLost()
+			return
+
+		case <-l.done:
+			return
+		}
+	}
+}
+
+func (l *Lease) markLost() {
+	l.closeOnce.Do(func() { close(l.done) })
+}
+
+// Done returns a channel that is closed once the lease is no longer held, either because a
+// renewal was rejected (someone else took over) or because the Campaign context was canceled
+func (l *Lease) Done() <-chan struct{} {
+	return l.done
+}
+
+// Resign releases the lease, deleting key only if it is still held by this candidate's identity.
+// It is a no-op if the lease was already lost
+func (l *Lease) Resign(ctx context.Context) error {
+	select {
+	case <-l.done:
+		return nil
+	default:
+	}
+
+	l.mu.Lock()
+	index := l.index
+	l.mu.Unlock()
+
+	l.markLost()
+
+	_, err := l.backend.CompareAndDelete(ctx, l.key, l.identity, index)
+	return err
+}
+
+// Leadership describes who currently holds a Client.Campaign key.
+type Leadership struct {
+	// Leader is the identity currently stored at the campaigned key
+	Leader string
+
+	// IsSelf reports whether Leader is the identity this Client campaigned with
+	IsSelf bool
+}
+
+// Campaign is Election's counterpart on Client: instead of a bare key, it campaigns for a field
+// previously mapped by Load or Save, and keeps that field updated with the current leader's
+// identity as a typed view on top of the same etcd master-loop (Get, atomic Create if the key is
+// absent, CompareAndSwap to refresh it or take it over, otherwise watch the current leader's key
+// for deletion or expiry and retry). The returned channel receives a Leadership every time the
+// leader changes, including the first one observed, and is closed once ctx is canceled.
+//
+// fieldPtr must point to a string field, and must already be tracked by c (as Election bypasses
+// the reflection layer, Campaign relies on it to resolve fieldPtr to its etcd path)
+func (c *Client) Campaign(ctx context.Context, fieldPtr interface{}, id string, ttl time.Duration) (<-chan Leadership, error) {
+	fieldValue := reflect.ValueOf(fieldPtr)
+	if fieldValue.Kind() == reflect.Ptr {
+		fieldValue = fieldValue.Elem()
+
+	} else if !fieldValue.CanAddr() {
+		return nil, ErrFieldNotAddr
+	}
+
+	if fieldValue.Kind() != reflect.String {
+		return nil, ErrFieldNotString
+	}
+
+	path, _, found := c.lookupInfo(fieldValue)
+	if !found {
+		return nil, ErrFieldNotMapped
+	}
+
+	out := make(chan Leadership)
+	go c.campaign(ctx, path, fieldValue, id, ttl, out)
+	return out, nil
+}
+
+// campaign runs the master-loop backing Campaign until ctx is canceled, emitting a Leadership on
+// out every time the leader changes and keeping field set to the current leader's identity
+func (c *Client) campaign(ctx context.Context, path string, field reflect.Value, id string, ttl time.Duration, out chan<- Leadership) {
+	defer close(out)
+
+	ttlSeconds := uint64(ttl / time.Second)
+
+	emit := func(leader string, isSelf bool) bool {
+		c.mu.Lock()
+		field.SetString(leader)
+		c.mu.Unlock()
+
+		select {
+		case out <- Leadership{Leader: leader, IsSelf: isSelf}:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	for ctx.Err() == nil {
+		node, err := c.backend.Get(ctx, path, false, false)
+		if err != nil {
+			if !keyNotFoundError(err) {
+				return
+			}
+
+			node, err = c.backend.Create(ctx, path, id, ttlSeconds)
+			if err != nil {
+				if alreadyExistsError(err) {
+					continue
+				}
+				return
+			}
+
+			if !emit(id, true) {
+				return
+			}
+			if !c.renewLeadership(ctx, path, id, ttlSeconds, node.ModifiedIndex) {
+				return
+			}
+			continue
+		}
+
+		if node.Value == id {
+			node, err = c.backend.CompareAndSwap(ctx, path, id, ttlSeconds, id, node.ModifiedIndex)
+			if err != nil {
+				continue
+			}
+
+			if !emit(id, true) {
+				return
+			}
+			if !c.renewLeadership(ctx, path, id, ttlSeconds, node.ModifiedIndex) {
+				return
+			}
+			continue
+		}
+
+		if !emit(node.Value, false) {
+			return
+		}
+		c.waitForLeaderChange(ctx, path, node.ModifiedIndex)
+	}
+}
+
+// renewLeadership refreshes path with CompareAndSwap whenever the remaining TTL drops below half
+// of its total duration, the same schedule Lease.renew uses. It returns false once ctx is
+// canceled, or true if a renewal was rejected, meaning leadership was lost and campaign should
+// retry acquiring it
+func (c *Client) renewLeadership(ctx context.Context, path, id string, ttlSeconds, index uint64) bool {
+	ticker := time.NewTicker(time.Duration(ttlSeconds) * time.Second / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			node, err := c.backend.CompareAndSwap(ctx, path, id, ttlSeconds, id, index)
+			if err != nil {
+				return true
+			}
+			index = node.ModifiedIndex
+
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// waitForLeaderChange blocks until path is deleted or expires (the current leader stepped down or
+// its lease lapsed) or ctx is canceled, so campaign can retry acquiring leadership
+func (c *Client) waitForLeaderChange(ctx context.Context, path string, waitIndex uint64) {
+	receiver := make(chan *Node)
+	stop := make(chan bool)
+	defer close(stop)
+
+	go c.backend.Watch(ctx, path, waitIndex+1, false, receiver, stop)
+
+	for {
+		select {
+		case node := <-receiver:
+			if node == nil {
+				return
+			}
+			switch node.Action {
+			case "delete", "expire":
+				return
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Observe streams the current leader identity for this lease's key: its present value first, then
+// its new value on every subsequent change, until ctx is canceled
+func (l *Lease) Observe(ctx context.Context) <-chan string {
+	out := make(chan string)
+
+	go func() {
+		defer close(out)
+
+		waitIndex := uint64(0)
+		if node, err := l.backend.Get(ctx, l.key, false, false); err == nil {
+			select {
+			case out <- node.Value:
+			case <-ctx.Done():
+				return
+			}
+			waitIndex = node.ModifiedIndex + 1
+		}
+
+		receiver := make(chan *Node)
+		stop := make(chan bool)
+		defer close(stop)
+
+		go l.backend.Watch(ctx, l.key, waitIndex, false, receiver, stop)
+
+		for {
+			select {
+			case node := <-receiver:
+				if node == nil {
+					return
+				}
+
+				select {
+				case out <- node.Value:
+				case <-ctx.Done():
+					return
+				}
+
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
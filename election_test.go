@@ -0,0 +1,143 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClientCampaign(t *testing.T) {
+	config := struct {
+		Leader string `etcd:"/leader"`
+	}{}
+
+	mock := NewClientMock()
+
+	c := Client{
+		backend: newV2Backend(mock),
+		config:  reflect.ValueOf(&config),
+		info:    make(map[string]info),
+		codecs:  defaultCodecs(),
+	}
+	c.preload(c.config, "", "")
+
+	leadership, err := c.Campaign(context.Background(), &config.Leader, "me", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error starting the campaign: %s", err)
+	}
+
+	select {
+	case leader := <-leadership:
+		if leader != (Leadership{Leader: "me", IsSelf: true}) {
+			t.Fatalf("expected to win an empty election as %q, found %+v", "me", leader)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the first leadership update")
+	}
+
+	if config.Leader != "me" {
+		t.Errorf("expected Leader to be set to %q, found %q", "me", config.Leader)
+	}
+}
+
+func TestClientCampaignAlreadyHeldByAnother(t *testing.T) {
+	config := struct {
+		Leader string `etcd:"/leader"`
+	}{}
+
+	mock := NewClientMock()
+
+	c := Client{
+		backend: newV2Backend(mock),
+		config:  reflect.ValueOf(&config),
+		info:    make(map[string]info),
+		codecs:  defaultCodecs(),
+	}
+	c.preload(c.config, "", "")
+
+	if _, err := mock.Create("/leader", "someone-else", 0); err != nil {
+		t.Fatalf("unexpected error seeding the mock: %s", err)
+	}
+
+	leadership, err := c.Campaign(context.Background(), &config.Leader, "me", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error starting the campaign: %s", err)
+	}
+
+	select {
+	case leader := <-leadership:
+		if leader != (Leadership{Leader: "someone-else", IsSelf: false}) {
+			t.Fatalf("expected to observe %q as the leader, found %+v", "someone-else", leader)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the first leadership update")
+	}
+}
+
+func TestElectionCampaign(t *testing.T) {
+	mock := NewClientMock()
+	e := NewElection(&Client{backend: newV2Backend(mock)})
+
+	lease, err := e.Campaign(context.Background(), "/leader", "me", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error campaigning: %s", err)
+	}
+	defer lease.Resign(context.Background())
+
+	select {
+	case <-lease.Done():
+		t.Fatal("lease reported as lost right after winning the campaign")
+	default:
+	}
+
+	node, err := mock.Get("/leader", false, false)
+	if err != nil {
+		t.Fatalf("unexpected error reading back the key: %s", err)
+	}
+	if node.Node.Value != "me" {
+		t.Errorf("expected the key to hold %q, found %q", "me", node.Node.Value)
+	}
+}
+
+func TestElectionCampaignLost(t *testing.T) {
+	mock := NewClientMock()
+
+	if _, err := mock.Create("/leader", "someone-else", 0); err != nil {
+		t.Fatalf("unexpected error seeding the mock: %s", err)
+	}
+
+	e := NewElection(&Client{backend: newV2Backend(mock)})
+
+	if _, err := e.Campaign(context.Background(), "/leader", "me", time.Minute); err != ErrElectionLost {
+		t.Fatalf("expected ErrElectionLost, found %v", err)
+	}
+}
+
+func TestElectionResign(t *testing.T) {
+	mock := NewClientMock()
+	e := NewElection(&Client{backend: newV2Backend(mock)})
+
+	lease, err := e.Campaign(context.Background(), "/leader", "me", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error campaigning: %s", err)
+	}
+
+	if err := lease.Resign(context.Background()); err != nil {
+		t.Fatalf("unexpected error resigning: %s", err)
+	}
+
+	select {
+	case <-lease.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected Done to be closed right after Resign")
+	}
+
+	if _, err := mock.Get("/leader", false, false); !keyNotFoundError(err) {
+		t.Errorf("expected the key to be gone after resigning, found %v", err)
+	}
+}
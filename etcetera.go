@@ -5,11 +5,15 @@
 package etcetera
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/coreos/go-etcd/etcd"
 )
@@ -30,37 +34,232 @@ var (
 	// ErrFieldNotAddr is throw when a field that cannot be addressable is used in a place that we
 	// need the pointer to identify the path related to the field
 	ErrFieldNotAddr = errors.New("etcetera: field must be a pointer or an addressable value")
+
+	// ErrFieldNotScalar is returned by SaveField, SaveFieldIf and DeleteCAS when asked to
+	// compare-and-swap (or compare-and-delete) a field that isn't backed by a single etcd key. Struct,
+	// slice and map fields span several keys, so a single compare-and-swap doesn't apply to them;
+	// SaveCAS skips such fields instead of returning this error
+	ErrFieldNotScalar = errors.New("etcetera: compare-and-swap only supports string, integer, float and bool fields")
 )
 
 // https://github.com/coreos/etcd/blob/master/error/error.go
 const (
-	etcdErrorCodeKeyNotFound  etcdErrorCode = 100 // used in tests
-	etcdErrorCodeNotFile      etcdErrorCode = 102 // used in tests
-	etcdErrorCodeNodeExist    etcdErrorCode = 105
-	etcdErrorCodeRaftInternal etcdErrorCode = 300 // used in tests
+	etcdErrorCodeKeyNotFound       etcdErrorCode = 100 // used in tests
+	etcdErrorCodeTestFailed        etcdErrorCode = 101
+	etcdErrorCodeNotFile           etcdErrorCode = 102 // used in tests
+	etcdErrorCodeNodeExist         etcdErrorCode = 105
+	etcdErrorCodeRaftInternal      etcdErrorCode = 300 // used in tests
+	etcdErrorCodeEventIndexCleared etcdErrorCode = 401
 )
 
+// ErrStaleVersion is returned by SaveField and SaveCAS when the compare-and-swap against etcd fails
+// because the field's value was changed by someone else since it was last loaded. HaveIndex is the
+// version the caller last saw; WantIndex is etcd's current version for the same path. Callers should
+// Load (or Watch) the field again before retrying
+type ErrStaleVersion struct {
+	Path      string
+	HaveIndex uint64
+	WantIndex uint64
+}
+
+func (e ErrStaleVersion) Error() string {
+	return fmt.Sprintf("etcetera: stale version for path “%s”: have %d, etcd has %d", e.Path, e.HaveIndex, e.WantIndex)
+}
+
 type etcdErrorCode int
 
-// Client stores the etcd connection, the configuration instance that we are managing and some extra
-// informations that are useful for controlling path versions and making the API simpler
+// Client stores the backend connection, the configuration instance that we are managing and some
+// extra informations that are useful for controlling path versions and making the API simpler
 type Client struct {
-	etcdClient client
-	config     reflect.Value
+	backend kv
+	config  reflect.Value
 
 	// info creates a correlation between a path to a info structure that stores some extra
 	// information and make the API usage easier
 	info map[string]info
+
+	// names maps an etcd path to the dotted chain of Go field names that leads to it (for example
+	// "Sub.Field"), used by WatchAll to report changes in terms of the configuration struct
+	names map[string]string
+
+	// codecs holds the codecs available to the codec struct tag option, seeded with defaultCodecs
+	// and extendable through RegisterCodec
+	codecs map[string]Codec
+
+	// leaseID is the shared lease granted by KeepAlive. Fields tagged "lease" are written attached
+	// to it instead of carrying their own TTL; it is zero until KeepAlive succeeds
+	leaseID int64
+
+	// leaseTTL is how long the shared lease lives between renewals, taken from Config.LeaseTTL
+	leaseTTL time.Duration
+
+	// namespace is prepended to every path built from the config struct's tags, taken from
+	// Config.Namespace. It is fixed at construction time since it is baked into every key in info
+	// and names the moment preload and buildFieldNames run
+	namespace string
+
+	// ttl tracks every key last written with a non-zero TTL, enabled by OnExpire. It is nil (the
+	// default) until OnExpire is called
+	ttl *ttlTracker
+
+	// cache holds decoded field values keyed by etcd path and ModifiedIndex, enabled by WithCache. It
+	// is nil (the default) when caching is disabled, which every call site checks before using it
+	cache *loadCache
+
+	// mu guards config and info against concurrent access between Events applying updates in the
+	// background and callers reading the configuration through Snapshot
+	mu sync.RWMutex
+
+	// auth, when set by WithAuth, is consulted once per Load to resolve the caller's roles, which
+	// are then checked against every tagged field's "acl" option. It is nil (the default) when no
+	// ACL enforcement is wanted, which Load checks before doing any of that work
+	auth AuthProvider
+
+	// hiddenPolicy controls how Load and Watch treat "_"-prefixed (or "hidden"-tagged) nodes. Its
+	// zero value, HideHidden, is the default until WithHiddenPolicy says otherwise
+	hiddenPolicy HiddenPolicy
+}
+
+// WithCache enables an in-process LRU cache of up to size decoded field values, so a Load or Watch
+// that observes the same ModifiedIndex as last time can restore the field straight from the cache
+// instead of re-parsing node.Value (and, for struct/map/slice fields, rebuilding the whole subtree).
+// It returns c so it can be chained right after NewClient or NewClientWithConfig. size <= 0 means
+// the cache never evicts on its own.
+func (c *Client) WithCache(size int) *Client {
+	c.cache = newLoadCache(size)
+	return c
+}
+
+// CacheStats reports how the cache enabled by WithCache has performed so far. It returns a zero
+// CacheStats when no cache is enabled.
+func (c *Client) CacheStats() CacheStats {
+	if c.cache == nil {
+		return CacheStats{}
+	}
+	return c.cache.statsSnapshot()
 }
 
 type info struct {
 	field   reflect.Value
 	version uint64
+
+	// value is the raw string last read from (or written to) etcd for a scalar or codec-handled
+	// field. It is empty for struct, slice and map fields, and only exists so SaveField and SaveCAS
+	// can issue a CompareAndSwap without an extra round-trip to fetch the previous value
+	value string
+
+	// codec is the name of the codec option used to marshal/unmarshal this field, empty when the
+	// field uses the built-in scalar handling
+	codec string
+}
+
+// scalarString returns the etcd representation of field and whether field is a scalar kind that
+// maps to a single etcd key (string, int, int64, any unsigned integer or float kind, or bool). Struct, slice and
+// map fields return false, since they span several keys
+func scalarString(field reflect.Value) (string, bool) {
+	switch field.Kind() {
+	case reflect.String:
+		return field.String(), true
+
+	case reflect.Int, reflect.Int64:
+		return strconv.FormatInt(field.Int(), 10), true
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(field.Uint(), 10), true
+
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(field.Float(), 'g', -1, 64), true
+
+	case reflect.Bool:
+		return strconv.FormatBool(field.Bool()), true
+
+	default:
+		return "", false
+	}
+}
+
+// Config groups the connection options accepted by NewClientWithConfig. It replaces the bare
+// []string of endpoints used by NewClient whenever callers need TLS, authentication, per-call
+// deadlines, or a backend other than BackendV2 (BackendKeysAPI, BackendV3).
+type Config struct {
+	// Endpoints are the etcd servers to connect to
+	Endpoints []string
+
+	// DialTimeout limits how long a connection attempt (or, on BackendKeysAPI, an individual
+	// request) can take before it is aborted
+	DialTimeout time.Duration
+
+	// TLS, when set, configures the client to talk to a secured etcd cluster
+	TLS *tls.Config
+
+	// Username and Password enable HTTP basic authentication against the etcd cluster
+	Username string
+	Password string
+
+	// Backend selects which underlying etcd client implementation is used. It defaults to
+	// BackendV2 for backward compatibility with NewClient
+	Backend BackendType
+
+	// LeaseTTL is how long the lease Client.KeepAlive grants (and keeps renewing) lives between
+	// renewals. It defaults to defaultLeaseTTL when zero. Only meaningful on backends implementing
+	// leaser (BackendV3)
+	LeaseTTL time.Duration
+
+	// Namespace, when set, is prepended to every key Load, Save and Watch use, so multiple
+	// applications can share one etcd cluster without their keys colliding. It is normalized to
+	// start with "/" and never end with one, so "myapp", "/myapp" and "/myapp/" all behave the same
+	Namespace string
+}
+
+// normalizeNamespace trims Config.Namespace down to the form every path is built from: no trailing
+// slash, and a leading one unless it's empty (meaning no namespace at all)
+func normalizeNamespace(namespace string) string {
+	namespace = strings.Trim(namespace, "/")
+	if len(namespace) == 0 {
+		return ""
+	}
+
+	return "/" + namespace
 }
 
 // NewClient internally build a etcd client object (go-etcd library). This internal object will not
 // be visible to make the API simpler
 func NewClient(machines []string, config interface{}) (*Client, error) {
+	return NewClientWithConfig(Config{Endpoints: machines, Backend: BackendV2}, config)
+}
+
+// NewClientV3 works like NewClient but talks to an etcd 3.x cluster over gRPC via the BackendV3
+// backend instead of the deprecated v2 Keys API, so users on modern clusters get the same
+// struct-tag reflection machinery without downgrading their server. Use NewClientWithConfig
+// instead if TLS, authentication or per-call deadlines are also needed.
+func NewClientV3(endpoints []string, config interface{}) (*Client, error) {
+	return NewClientWithConfig(Config{Endpoints: endpoints, Backend: BackendV3}, config)
+}
+
+// NewV3ClientWithLease works like NewClientV3, but also grants a shared lease of leaseTTL and
+// starts keeping it alive right away, as if KeepAlive had been called immediately afterwards. Use
+// it when every "lease" tagged field should be ready to Save as soon as the Client is returned,
+// instead of requiring a separate KeepAlive call first.
+func NewV3ClientWithLease(ctx context.Context, endpoints []string, leaseTTL time.Duration, config interface{}) (*Client, <-chan struct{}, error) {
+	c, err := NewClientWithConfig(Config{Endpoints: endpoints, Backend: BackendV3, LeaseTTL: leaseTTL}, config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keptAlive, err := c.KeepAlive(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c, keptAlive, nil
+}
+
+// NewClientWithConfig works like NewClient but accepts a Config, giving access to TLS,
+// authentication, per-call deadlines and the BackendKeysAPI and BackendV3 backends. TLS and
+// authentication apply to every backend, including BackendV2; per-call deadlines don't, since the
+// legacy go-etcd client predates context.Context, so threading a context.Context through
+// Load/Save/Watch/Version/Delete only has effect when Backend is not BackendV2
+func NewClientWithConfig(cfg Config, config interface{}) (*Client, error) {
 	configValue := reflect.ValueOf(config)
 
 	if configValue.Kind() != reflect.Ptr ||
@@ -69,17 +268,27 @@ func NewClient(machines []string, config interface{}) (*Client, error) {
 		return nil, ErrInvalidConfig
 	}
 
+	backend, err := newBackend(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	c := &Client{
-		etcdClient: etcd.NewClient(machines),
-		config:     configValue,
-		info:       make(map[string]info),
+		backend:   backend,
+		config:    configValue,
+		info:      make(map[string]info),
+		names:     make(map[string]string),
+		codecs:    defaultCodecs(),
+		leaseTTL:  cfg.LeaseTTL,
+		namespace: normalizeNamespace(cfg.Namespace),
 	}
 
-	c.preload(c.config, "")
+	c.preload(c.config, c.namespace, "")
+	c.buildFieldNames(c.config, c.namespace, "")
 	return c, nil
 }
 
-func (c *Client) preload(field reflect.Value, pathSuffix string) {
+func (c *Client) preload(field reflect.Value, pathSuffix, codecName string) {
 	field = field.Elem()
 
 	switch field.Kind() {
@@ -88,13 +297,13 @@ func (c *Client) preload(field reflect.Value, pathSuffix string) {
 			subfield := field.Field(i)
 			subfieldType := field.Type().Field(i)
 
-			path := subfieldType.Tag.Get("etcd")
+			path, opts := parseTag(subfieldType.Tag.Get("etcd"))
 			if len(path) == 0 {
 				continue
 			}
 			path = pathSuffix + path
 
-			c.preload(subfield.Addr(), path)
+			c.preload(subfield.Addr(), path, opts.Codec)
 		}
 	}
 
@@ -104,16 +313,52 @@ func (c *Client) preload(field reflect.Value, pathSuffix string) {
 
 	c.info[pathSuffix] = info{
 		field: field,
+		codec: codecName,
 	}
 }
 
+// root returns the path Events and WatchAll should watch recursively to observe every field the
+// client manages: the namespace itself, or "/" when none is configured
+func (c *Client) root() string {
+	if len(c.namespace) == 0 {
+		return "/"
+	}
+
+	return c.namespace
+}
+
+// lookupInfo finds the info entry (and its path) matching fieldValue, using the same pointer,
+// type and name comparison used throughout the package to avoid mismatches between a struct and
+// its first field (which share the same memory address)
+func (c *Client) lookupInfo(fieldValue reflect.Value) (string, info, bool) {
+	for path, fieldInfo := range c.info {
+		if fieldInfo.field.Addr().Pointer() == fieldValue.Addr().Pointer() &&
+			fieldInfo.field.Type().Name() == fieldValue.Type().Name() &&
+			fieldInfo.field.Kind() == fieldValue.Kind() {
+
+			return path, fieldInfo, true
+		}
+	}
+
+	return "", info{}, false
+}
+
 // Save stores a structure in etcd. Only attributes with the tag 'etcd' are going to be saved.
-// Supported types are 'struct', 'slice', 'map', 'string', 'int', 'int64' and 'bool'
-func (c *Client) Save() error {
-	return c.save(c.config, "")
+// Supported types are 'struct', 'slice', 'map', 'string', 'int', 'int64', the unsigned integer and
+// float kinds, 'bool' and pointers to any of those (a nil pointer leaves the key absent in etcd). A
+// field whose tag carries a 'codec' option, or whose type is time.Duration, time.Time or implements
+// encoding.TextMarshaler, is instead marshaled through that Codec; see Client.RegisterCodec. The
+// 'ttl' tag option, when set, makes the key expire in etcd on its own; the 'lease' tag option
+// instead attaches the key to the shared lease granted by KeepAlive, so it expires together with
+// the rest of that group
+func (c *Client) Save(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.save(ctx, c.config, c.namespace)
 }
 
-func (c *Client) save(config reflect.Value, pathSuffix string) error {
+func (c *Client) save(ctx context.Context, config reflect.Value, pathSuffix string) error {
 	if config.Kind() == reflect.Ptr {
 		config = config.Elem()
 	} else if config.Kind() != reflect.Struct {
@@ -124,77 +369,119 @@ func (c *Client) save(config reflect.Value, pathSuffix string) error {
 		field := config.Field(i)
 		fieldType := config.Type().Field(i)
 
-		path := fieldType.Tag.Get("etcd")
+		path, opts := parseTag(fieldType.Tag.Get("etcd"))
 		if len(path) == 0 {
 			continue
 		}
 		path = pathSuffix + path
 
-		switch field.Kind() {
+		// A nil pointer means the key is left absent in etcd; a non-nil one is saved as whatever it
+		// points to
+		writeField := field
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				continue
+			}
+			writeField = field.Elem()
+		}
+
+		if opts.OmitEmpty && writeField.IsZero() {
+			continue
+		}
+
+		ttl := uint64(opts.TTL.Seconds())
+
+		if codec, ok := c.resolveCodec(writeField, opts.Codec); ok {
+			value, err := codec.Marshal(writeField)
+			if err != nil {
+				return err
+			}
+
+			if _, err := c.writeKey(ctx, path, value, ttl, opts.Lease); err != nil {
+				return err
+			}
+
+			c.info[path] = info{field: field, value: value, codec: opts.Codec}
+			continue
+		}
+
+		switch writeField.Kind() {
 		case reflect.Struct:
-			if err := c.save(field, path); err != nil {
+			if err := c.save(ctx, writeField, path); err != nil {
 				return err
 			}
 
 		case reflect.Map:
-			if _, err := c.etcdClient.CreateDir(path, 0); err != nil && !alreadyExistsError(err) {
+			if _, err := c.backend.CreateDir(ctx, path, 0); err != nil && !alreadyExistsError(err) {
 				return err
 			}
 
-			for _, key := range field.MapKeys() {
-				value := field.MapIndex(key)
+			for _, key := range writeField.MapKeys() {
+				value := writeField.MapIndex(key)
 
-				if _, err := c.etcdClient.Set(path+"/"+key.String(), value.String(), 0); err != nil {
+				if _, err := c.writeKey(ctx, path+"/"+key.String(), value.String(), ttl, opts.Lease); err != nil {
 					return err
 				}
 			}
 
 		case reflect.Slice:
-			if _, err := c.etcdClient.CreateDir(path, 0); err != nil && !alreadyExistsError(err) {
+			if _, err := c.backend.CreateDir(ctx, path, 0); err != nil && !alreadyExistsError(err) {
 				return err
 			}
 
-			for i := 0; i < field.Len(); i++ {
-				item := field.Index(i)
+			for i := 0; i < writeField.Len(); i++ {
+				item := writeField.Index(i)
 
 				if item.Kind() == reflect.Struct {
 					tmpPath := fmt.Sprintf("%s/%d", path, i)
 
-					if _, err := c.etcdClient.CreateDir(tmpPath, 0); err != nil && !alreadyExistsError(err) {
+					if _, err := c.backend.CreateDir(ctx, tmpPath, 0); err != nil && !alreadyExistsError(err) {
 						return err
 					}
 
-					if err := c.save(item, tmpPath); err != nil {
+					if err := c.save(ctx, item, tmpPath); err != nil {
 						return err
 					}
 
 				} else {
-					if _, err := c.etcdClient.CreateInOrder(path, item.String(), 0); err != nil {
+					if _, err := c.backend.CreateInOrder(ctx, path, item.String(), ttl); err != nil {
 						return err
 					}
 				}
 			}
 
 		case reflect.String:
-			value := field.Interface().(string)
-			if _, err := c.etcdClient.Set(path, value, 0); err != nil {
+			value := writeField.Interface().(string)
+			if _, err := c.writeKey(ctx, path, value, ttl, opts.Lease); err != nil {
 				return err
 			}
 
 		case reflect.Int:
-			value := field.Interface().(int)
-			if _, err := c.etcdClient.Set(path, strconv.FormatInt(int64(value), 10), 0); err != nil {
+			value := writeField.Interface().(int)
+			if _, err := c.writeKey(ctx, path, strconv.FormatInt(int64(value), 10), ttl, opts.Lease); err != nil {
 				return err
 			}
 
 		case reflect.Int64:
-			value := field.Interface().(int64)
-			if _, err := c.etcdClient.Set(path, strconv.FormatInt(value, 10), 0); err != nil {
+			value := writeField.Interface().(int64)
+			if _, err := c.writeKey(ctx, path, strconv.FormatInt(value, 10), ttl, opts.Lease); err != nil {
+				return err
+			}
+
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			value := writeField.Uint()
+			if _, err := c.writeKey(ctx, path, strconv.FormatUint(value, 10), ttl, opts.Lease); err != nil {
+				return err
+			}
+
+		case reflect.Float32, reflect.Float64:
+			value := writeField.Float()
+			if _, err := c.writeKey(ctx, path, strconv.FormatFloat(value, 'g', -1, 64), ttl, opts.Lease); err != nil {
 				return err
 			}
 
 		case reflect.Bool:
-			value := field.Interface().(bool)
+			value := writeField.Interface().(bool)
 
 			var valueStr string
 			if value {
@@ -203,19 +490,43 @@ func (c *Client) save(config reflect.Value, pathSuffix string) error {
 				valueStr = "false"
 			}
 
-			if _, err := c.etcdClient.Set(path, valueStr, 0); err != nil {
+			if _, err := c.writeKey(ctx, path, valueStr, ttl, opts.Lease); err != nil {
 				return err
 			}
 		}
 
+		valueStr, _ := scalarString(writeField)
 		c.info[path] = info{
 			field: field,
+			value: valueStr,
 		}
 	}
 
 	return nil
 }
 
+// writeKey saves value to path, either attached to the Client's shared lease (when lease is true
+// and KeepAlive has granted one on a backend that supports it) or with its own ttl, falling back
+// to ttl when no shared lease is available
+func (c *Client) writeKey(ctx context.Context, path, value string, ttl uint64, lease bool) (*Node, error) {
+	node, err := c.writeKeyNode(ctx, path, value, ttl, lease)
+	if err == nil && ttl > 0 && c.ttl != nil {
+		c.ttl.track(path, time.Duration(ttl)*time.Second)
+	}
+
+	return node, err
+}
+
+func (c *Client) writeKeyNode(ctx context.Context, path, value string, ttl uint64, lease bool) (*Node, error) {
+	if lease && c.leaseID != 0 {
+		if granter, ok := c.backend.(leaser); ok {
+			return granter.SetWithLease(ctx, path, value, c.leaseID)
+		}
+	}
+
+	return c.backend.Set(ctx, path, value, ttl)
+}
+
 func alreadyExistsError(err error) bool {
 	etcderr, ok := err.(*etcd.EtcdError)
 	if !ok {
@@ -225,14 +536,161 @@ func alreadyExistsError(err error) bool {
 	return etcderr.ErrorCode == int(etcdErrorCodeNodeExist)
 }
 
+func keyNotFoundError(err error) bool {
+	etcderr, ok := err.(*etcd.EtcdError)
+	if !ok {
+		return false
+	}
+
+	return etcderr.ErrorCode == int(etcdErrorCodeKeyNotFound)
+}
+
+// compactedError reports whether err signals that the watched revision was compacted away by
+// etcd, meaning a watch cannot resume from where it left off and the caller has to reload the
+// configuration and restart watching from the current revision instead
+func compactedError(err error) bool {
+	etcderr, ok := err.(*etcd.EtcdError)
+	if !ok {
+		return false
+	}
+
+	return etcderr.ErrorCode == int(etcdErrorCodeEventIndexCleared)
+}
+
+func staleVersionError(path string, haveIndex uint64, err error) error {
+	etcderr, ok := err.(*etcd.EtcdError)
+	if !ok || etcderr.ErrorCode != int(etcdErrorCodeTestFailed) {
+		return err
+	}
+
+	return ErrStaleVersion{Path: path, HaveIndex: haveIndex, WantIndex: etcderr.Index}
+}
+
+// SaveField stores a single previously loaded or saved field back to etcd using a compare-and-swap
+// keyed on the version and value last seen by Load, Save, SaveField or Watch, instead of
+// unconditionally overwriting whatever is currently stored. If the value was changed by someone
+// else in the meantime, ErrStaleVersion is returned so the caller can Load again and retry
+func (c *Client) SaveField(ctx context.Context, field interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fieldValue := reflect.ValueOf(field)
+	if fieldValue.Kind() == reflect.Ptr {
+		fieldValue = fieldValue.Elem()
+
+	} else if !fieldValue.CanAddr() {
+		return ErrFieldNotAddr
+	}
+
+	path, fieldInfo, found := c.lookupInfo(fieldValue)
+	if !found {
+		return ErrFieldNotMapped
+	}
+
+	return c.saveFieldCAS(ctx, path, fieldInfo)
+}
+
+// SaveCAS saves every scalar field currently tracked in c.info (populated by a prior Load, Save,
+// SaveField or Watch) back to etcd, each guarded by its own compare-and-swap. It stops at the first
+// field that was changed by someone else and returns ErrStaleVersion, leaving fields not yet
+// processed untouched
+func (c *Client) SaveCAS(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for path, fieldInfo := range c.info {
+		if _, ok := scalarString(fieldInfo.field); !ok {
+			continue
+		}
+
+		if err := c.saveFieldCAS(ctx, path, fieldInfo); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SaveFieldIf stores a single previously loaded or saved field back to etcd using a compare-and-
+// swap keyed on expectedVersion instead of the version this Client last saw via Load, Save,
+// SaveField or Watch (see SaveField). It's for a caller that tracks a field's version itself, for
+// example one obtained from Version by a different process sharing the same key, where this
+// Client's own info cache may already be stale by the time the write happens. Unlike SaveField, the
+// compare only guards the version, not the value last seen locally, since that value has no
+// bearing on a version a caller supplied independently. If expectedVersion no longer matches,
+// ErrStaleVersion is returned the same way SaveField's does
+func (c *Client) SaveFieldIf(ctx context.Context, field interface{}, expectedVersion uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fieldValue := reflect.ValueOf(field)
+	if fieldValue.Kind() == reflect.Ptr {
+		fieldValue = fieldValue.Elem()
+
+	} else if !fieldValue.CanAddr() {
+		return ErrFieldNotAddr
+	}
+
+	path, fieldInfo, found := c.lookupInfo(fieldValue)
+	if !found {
+		return ErrFieldNotMapped
+	}
+
+	valueStr, ok := scalarString(fieldInfo.field)
+	if !ok {
+		return ErrFieldNotScalar
+	}
+
+	node, err := c.backend.CompareAndSwap(ctx, path, valueStr, 0, "", expectedVersion)
+	if err != nil {
+		return staleVersionError(path, expectedVersion, err)
+	}
+
+	c.info[path] = info{field: fieldInfo.field, version: node.ModifiedIndex, value: valueStr, codec: fieldInfo.codec}
+	return nil
+}
+
+func (c *Client) saveFieldCAS(ctx context.Context, path string, fieldInfo info) error {
+	valueStr, ok := scalarString(fieldInfo.field)
+	if !ok {
+		return ErrFieldNotScalar
+	}
+
+	node, err := c.backend.CompareAndSwap(ctx, path, valueStr, 0, fieldInfo.value, fieldInfo.version)
+	if err != nil {
+		return staleVersionError(path, fieldInfo.version, err)
+	}
+
+	c.info[path] = info{field: fieldInfo.field, version: node.ModifiedIndex, value: valueStr, codec: fieldInfo.codec}
+	return nil
+}
+
 // Load retrieves the data from the etcd into the given structure. Only attributes with the tag
-// 'etcd' will be filled. Supported types are 'struct', 'slice', 'map', 'string', 'int', 'int64' and
-// 'bool'
-func (c *Client) Load() error {
-	return c.load(c.config, "")
+// 'etcd' will be filled. See Save for the supported types and the 'codec' tag option; a pointer
+// field with no key in etcd is left as it is (nil, unless it was already set) instead of failing
+// the whole Load. When WithAuth
+// configured an AuthProvider, fields tagged with an "acl" option the caller's roles don't grant
+// are left unset and Load returns a PartialLoadError listing them once the rest has loaded
+func (c *Client) Load(ctx context.Context) error {
+	filter, err := newACLFilter(ctx, c.auth)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	err = c.load(ctx, c.config, c.namespace, false, filter)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return filter.err()
 }
 
-func (c *Client) load(config reflect.Value, pathSuffix string) error {
+// load is Load's implementation. tolerateMissing is set by LoadLayered: instead of failing the
+// whole load, a top-level field with no key in etcd is left holding whatever value a previous
+// Source layer gave it. filter is nil unless WithAuth configured an AuthProvider
+func (c *Client) load(ctx context.Context, config reflect.Value, pathSuffix string, tolerateMissing bool, filter *aclFilter) error {
 	if config.Kind() != reflect.Ptr {
 		return ErrInvalidConfig
 	}
@@ -242,18 +700,41 @@ func (c *Client) load(config reflect.Value, pathSuffix string) error {
 		field := config.Field(i)
 		fieldType := config.Type().Field(i)
 
-		path := fieldType.Tag.Get("etcd")
+		path, opts := parseTag(fieldType.Tag.Get("etcd"))
 		if len(path) == 0 {
 			continue
 		}
 		path = pathSuffix + path
 
-		response, err := c.etcdClient.Get(path, true, true)
+		if !c.hiddenPolicy.allows(isHidden(path, opts.Hidden)) {
+			continue
+		}
+
+		if !filter.allowed(opts.ACL) {
+			filter.skip(path)
+			continue
+		}
+
+		node, err := c.backend.Get(ctx, path, true, true)
 		if err != nil {
+			// A pointer field with no key in etcd is left nil instead of failing the whole Load
+			if field.Kind() == reflect.Ptr && keyNotFoundError(err) {
+				continue
+			}
+			if tolerateMissing && keyNotFoundError(err) {
+				continue
+			}
 			return err
 		}
 
-		if err := c.fillField(field, response.Node, path); err != nil {
+		targetField := field
+		if field.Kind() == reflect.Ptr {
+			targetField = reflect.New(field.Type().Elem())
+			field.Set(targetField)
+			targetField = targetField.Elem()
+		}
+
+		if err := c.fillField(targetField, node, path, opts.Codec, filter); err != nil {
 			return err
 		}
 	}
@@ -261,55 +742,148 @@ func (c *Client) load(config reflect.Value, pathSuffix string) error {
 	return nil
 }
 
-// Watch keeps track of a specific field in etcd using a long polling strategy. When a change is
-// detected the callback function will run. When you want to stop watching the field, just close the
-// returning channel
-func (c *Client) Watch(field interface{}, callback func()) (chan<- bool, error) {
+// Delete removes a previously loaded or saved field from etcd. Struct, slice and map fields are
+// removed recursively along with everything below them
+func (c *Client) Delete(ctx context.Context, field interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	fieldValue := reflect.ValueOf(field)
 	if fieldValue.Kind() == reflect.Ptr {
 		fieldValue = fieldValue.Elem()
 
 	} else if !fieldValue.CanAddr() {
-		return nil, ErrFieldNotAddr
+		return ErrFieldNotAddr
+	}
+
+	path, _, found := c.lookupInfo(fieldValue)
+	if !found {
+		return ErrFieldNotMapped
+	}
+
+	switch fieldValue.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice:
+		if _, err := c.backend.Delete(ctx, path, true); err != nil {
+			return err
+		}
+
+	default:
+		if _, err := c.backend.Delete(ctx, path, false); err != nil {
+			return err
+		}
+	}
+
+	delete(c.info, path)
+	if c.cache != nil {
+		c.cache.invalidate(path)
+	}
+	if c.ttl != nil {
+		c.ttl.untrack(path)
+	}
+	return nil
+}
+
+// DeleteCAS removes a single previously loaded or saved scalar field from etcd using a
+// compare-and-delete keyed on the version and value last seen by Load, Save, SaveField, SaveCAS or
+// Watch, instead of Delete's unconditional removal. If the value was changed by someone else in the
+// meantime, ErrStaleVersion is returned so the caller can Load again and retry; struct, slice and
+// map fields return ErrFieldNotScalar since a single compare-and-delete doesn't apply to a whole
+// subtree
+func (c *Client) DeleteCAS(ctx context.Context, field interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fieldValue := reflect.ValueOf(field)
+	if fieldValue.Kind() == reflect.Ptr {
+		fieldValue = fieldValue.Elem()
+
+	} else if !fieldValue.CanAddr() {
+		return ErrFieldNotAddr
 	}
 
-	var path string
-	var info info
+	path, fieldInfo, found := c.lookupInfo(fieldValue)
+	if !found {
+		return ErrFieldNotMapped
+	}
 
-	found := false
-	for path, info = range c.info {
-		// Match the pointer, type and name to avoid problems for struct and first field that have the
-		// same memory address
-		if info.field.Addr().Pointer() == fieldValue.Addr().Pointer() &&
-			info.field.Type().Name() == fieldValue.Type().Name() &&
-			info.field.Kind() == fieldValue.Kind() {
+	if _, ok := scalarString(fieldInfo.field); !ok {
+		return ErrFieldNotScalar
+	}
 
-			found = true
-			break
+	if _, err := c.backend.CompareAndDelete(ctx, path, fieldInfo.value, fieldInfo.version); err != nil {
+		return staleVersionError(path, fieldInfo.version, err)
+	}
+
+	delete(c.info, path)
+	if c.cache != nil {
+		c.cache.invalidate(path)
+	}
+	if c.ttl != nil {
+		c.ttl.untrack(path)
+	}
+	return nil
+}
+
+// OnExpire starts a background goroutine that fires cb with a key's path as soon as the TTL it was
+// last Saved with would have elapsed, first removing that key from the local info cache. It mirrors
+// the expiry etcd itself would apply, but locally and without polling, so OnExpire only fires for
+// keys this Client has Saved with a non-zero "ttl" tag option since OnExpire was called; it does
+// not retroactively track keys saved before it runs, and it does not confirm the key actually
+// expired in etcd. The goroutine runs until ctx is canceled.
+func (c *Client) OnExpire(ctx context.Context, cb func(path string)) {
+	c.mu.Lock()
+	tracker := newTTLTracker(func(path string) {
+		c.mu.Lock()
+		delete(c.info, path)
+		if c.cache != nil {
+			c.cache.invalidate(path)
 		}
+		c.mu.Unlock()
+
+		cb(path)
+	})
+	c.ttl = tracker
+	c.mu.Unlock()
+
+	go tracker.run(ctx)
+}
+
+// Watch keeps track of a specific field in etcd using a long polling strategy. When a change is
+// detected the callback function will run. When you want to stop watching the field, just close the
+// returning channel
+func (c *Client) Watch(ctx context.Context, field interface{}, callback func()) (chan<- bool, error) {
+	fieldValue := reflect.ValueOf(field)
+	if fieldValue.Kind() == reflect.Ptr {
+		fieldValue = fieldValue.Elem()
+
+	} else if !fieldValue.CanAddr() {
+		return nil, ErrFieldNotAddr
 	}
 
+	path, fieldInfo, found := c.lookupInfo(fieldValue)
 	if !found {
 		return nil, ErrFieldNotMapped
 	}
 
 	stop := make(chan bool)
-	receiver := make(chan *etcd.Response)
+	receiver := make(chan *Node)
 
 	// We are always retrieving the last version (index) of the path
-	go c.etcdClient.Watch(path, 0, true, receiver, stop)
+	go c.backend.Watch(ctx, path, 0, true, receiver, stop)
 
 	go func() {
 		for {
 			select {
-			case response := <-receiver:
-				if response != nil {
+			case node := <-receiver:
+				if node != nil {
 					// When watching a directory (slice, map or structure) the response will be from the node
 					// that changed and not the entire directory. So we need to query the directory again with
 					// recursion to load it correctly.
-					response, err := c.etcdClient.Get(path, true, true)
+					node, err := c.backend.Get(ctx, path, true, true)
 					if err == nil {
-						c.fillField(fieldValue, response.Node, path)
+						c.mu.Lock()
+						c.fillField(fieldValue, node, path, fieldInfo.codec, nil)
+						c.mu.Unlock()
 						callback()
 					}
 				}
@@ -323,22 +897,146 @@ func (c *Client) Watch(field interface{}, callback func()) (chan<- bool, error)
 	return stop, nil
 }
 
-func (c *Client) fillField(field reflect.Value, node *etcd.Node, pathSuffix string) error {
+// WatchDebounced works like Watch, but instead of reloading and calling back on every single event,
+// it coalesces events into a single reload and callback: every event restarts an interval-long
+// timer, and the reload runs once interval passes with no further event. This is the efficient way to watch a struct, slice or map field: each one spans several
+// etcd keys, so a burst of changes landing close together (a slice rewritten element by element,
+// say) would otherwise reload the whole subtree and call back once per leaf instead of once per
+// burst. cb receives the ModifiedIndex of the last event folded into the burst it reports
+func (c *Client) WatchDebounced(ctx context.Context, field interface{}, interval time.Duration, cb func(revision uint64)) (chan<- bool, error) {
+	fieldValue := reflect.ValueOf(field)
+	if fieldValue.Kind() == reflect.Ptr {
+		fieldValue = fieldValue.Elem()
+
+	} else if !fieldValue.CanAddr() {
+		return nil, ErrFieldNotAddr
+	}
+
+	path, fieldInfo, found := c.lookupInfo(fieldValue)
+	if !found {
+		return nil, ErrFieldNotMapped
+	}
+
+	stop := make(chan bool)
+	receiver := make(chan *Node)
+
+	// We are always retrieving the last version (index) of the path
+	go c.backend.Watch(ctx, path, 0, true, receiver, stop)
+
+	go func() {
+		timer := time.NewTimer(interval)
+		if !timer.Stop() {
+			<-timer.C
+		}
+		defer timer.Stop()
+
+		var pending bool
+		var revision uint64
+
+		for {
+			select {
+			case node := <-receiver:
+				if node == nil {
+					continue
+				}
+
+				revision = node.ModifiedIndex
+				if pending {
+					if !timer.Stop() {
+						select {
+						case <-timer.C:
+						default:
+						}
+					}
+				}
+				pending = true
+				timer.Reset(interval)
+
+			case <-timer.C:
+				if !pending {
+					continue
+				}
+				pending = false
+
+				// Just like Watch, the debounced event only tells us something under path changed, not
+				// what, so the whole subtree is reloaded with recursion
+				node, err := c.backend.Get(ctx, path, true, true)
+				if err == nil {
+					c.mu.Lock()
+					c.fillField(fieldValue, node, path, fieldInfo.codec, nil)
+					c.mu.Unlock()
+					cb(revision)
+				}
+
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return stop, nil
+}
+
+// fillField restores field from node, using the cache enabled by WithCache (if any) to skip
+// decoding entirely when node.ModifiedIndex matches what was cached for this path last time.
+// filter is nil unless Load resolved an AuthProvider via WithAuth; Watch always passes nil since
+// ACL filtering only applies to Load.
+func (c *Client) fillField(field reflect.Value, node *Node, pathSuffix string, codecName string, filter *aclFilter) error {
+	if c.cache != nil {
+		if entry, ok := c.cache.get(node.Key, node.ModifiedIndex); ok {
+			field.Set(deepCopy(entry.value))
+			c.info[node.Key] = info{field: field, version: entry.modifiedIndex, value: entry.valueStr, codec: entry.codec}
+			return nil
+		}
+	}
+
+	if err := c.fillFieldDecode(field, node, pathSuffix, codecName, filter); err != nil {
+		return err
+	}
+
+	if c.cache != nil {
+		c.cache.set(node.Key, node.ModifiedIndex, field, c.info[node.Key].value, codecName)
+	}
+
+	return nil
+}
+
+// fillFieldDecode is fillField's actual decode logic, applying node's value(s) to field by codec,
+// or by recursing through struct/map/slice children, or by parsing a scalar directly
+func (c *Client) fillFieldDecode(field reflect.Value, node *Node, pathSuffix string, codecName string, filter *aclFilter) error {
+	if codec, ok := c.resolveCodec(field, codecName); ok {
+		if err := codec.Unmarshal(node.Value, field); err != nil {
+			return err
+		}
+
+		c.info[node.Key] = info{field: field, version: node.ModifiedIndex, value: node.Value, codec: codecName}
+		return nil
+	}
+
 	switch field.Kind() {
 	case reflect.Struct:
 		for i := 0; i < field.NumField(); i++ {
 			subfield := field.Field(i)
 			subfieldType := field.Type().Field(i)
 
-			path := subfieldType.Tag.Get("etcd")
+			path, opts := parseTag(subfieldType.Tag.Get("etcd"))
 			if len(path) == 0 {
 				continue
 			}
 			path = pathSuffix + path
 
+			if !c.hiddenPolicy.allows(isHidden(path, opts.Hidden)) {
+				continue
+			}
+
+			if !filter.allowed(opts.ACL) {
+				filter.skip(path)
+				continue
+			}
+
 			for _, child := range node.Nodes {
 				if path == child.Key {
-					if err := c.fillField(subfield, child, path); err != nil {
+					if err := c.fillField(subfield, child, path, opts.Codec, filter); err != nil {
 						return err
 					}
 					break
@@ -350,6 +1048,10 @@ func (c *Client) fillField(field reflect.Value, node *etcd.Node, pathSuffix stri
 		field.Set(reflect.MakeMap(field.Type()))
 
 		for _, node := range node.Nodes {
+			if !c.hiddenPolicy.allows(isHidden(node.Key, false)) {
+				continue
+			}
+
 			pathParts := strings.Split(node.Key, "/")
 
 			field.SetMapIndex(
@@ -372,14 +1074,23 @@ func (c *Client) fillField(field reflect.Value, node *etcd.Node, pathSuffix stri
 						subfield := newStruct.Field(j)
 						subfieldType := newStruct.Type().Field(j)
 
-						path := subfieldType.Tag.Get("etcd")
+						path, subOpts := parseTag(subfieldType.Tag.Get("etcd"))
 						if len(path) == 0 {
 							continue
 						}
 						path = fmt.Sprintf("%s/%d%s", pathSuffix, i, path)
 
 						if path == subitem.Key {
-							if err := c.fillField(subfield, subitem, path); err != nil {
+							if !c.hiddenPolicy.allows(isHidden(path, subOpts.Hidden)) {
+								continue SubitemLoop
+							}
+
+							if !filter.allowed(subOpts.ACL) {
+								filter.skip(path)
+								continue SubitemLoop
+							}
+
+							if err := c.fillField(subfield, subitem, path, subOpts.Codec, filter); err != nil {
 								return err
 							}
 							continue SubitemLoop
@@ -414,6 +1125,26 @@ func (c *Client) fillField(field reflect.Value, node *etcd.Node, pathSuffix stri
 				field.Set(reflect.Append(field, reflect.ValueOf(value)))
 			}
 
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			for _, node := range node.Nodes {
+				value, err := strconv.ParseUint(node.Value, 10, 64)
+				if err != nil {
+					return err
+				}
+
+				field.Set(reflect.Append(field, reflect.ValueOf(value).Convert(field.Type().Elem())))
+			}
+
+		case reflect.Float32, reflect.Float64:
+			for _, node := range node.Nodes {
+				value, err := strconv.ParseFloat(node.Value, 64)
+				if err != nil {
+					return err
+				}
+
+				field.Set(reflect.Append(field, reflect.ValueOf(value).Convert(field.Type().Elem())))
+			}
+
 		case reflect.Bool:
 			for _, node := range node.Nodes {
 				if node.Value == "true" {
@@ -435,6 +1166,22 @@ func (c *Client) fillField(field reflect.Value, node *etcd.Node, pathSuffix stri
 
 		field.SetInt(value)
 
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value, err := strconv.ParseUint(node.Value, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		field.SetUint(value)
+
+	case reflect.Float32, reflect.Float64:
+		value, err := strconv.ParseFloat(node.Value, 64)
+		if err != nil {
+			return err
+		}
+
+		field.SetFloat(value)
+
 	case reflect.Bool:
 		if node.Value == "true" {
 			field.SetBool(true)
@@ -443,9 +1190,11 @@ func (c *Client) fillField(field reflect.Value, node *etcd.Node, pathSuffix stri
 		}
 	}
 
+	valueStr, _ := scalarString(field)
 	c.info[node.Key] = info{
 		field:   field,
 		version: node.ModifiedIndex,
+		value:   valueStr,
 	}
 
 	return nil
@@ -453,7 +1202,10 @@ func (c *Client) fillField(field reflect.Value, node *etcd.Node, pathSuffix stri
 
 // Version returns the current version of a field retrieved from etcd. It does not query etcd for
 // the latest version. When the field was not retrieved from etcd yet, the version 0 is returned
-func (c *Client) Version(field interface{}) (uint64, error) {
+func (c *Client) Version(ctx context.Context, field interface{}) (uint64, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	fieldValue := reflect.ValueOf(field)
 	if fieldValue.Kind() == reflect.Ptr {
 		fieldValue = fieldValue.Elem()
@@ -462,16 +1214,10 @@ func (c *Client) Version(field interface{}) (uint64, error) {
 		return 0, ErrFieldNotAddr
 	}
 
-	for _, info := range c.info {
-		// Match the pointer, type and name to avoid problems for struct and first field that have the
-		// same memory address
-		if info.field.Addr().Pointer() == fieldValue.Addr().Pointer() &&
-			info.field.Type().Name() == fieldValue.Type().Name() &&
-			info.field.Kind() == fieldValue.Kind() {
-
-			return info.version, nil
-		}
+	_, fieldInfo, found := c.lookupInfo(fieldValue)
+	if !found {
+		return 0, ErrFieldNotMapped
 	}
 
-	return 0, ErrFieldNotMapped
+	return fieldInfo.version, nil
 }
@@ -5,11 +5,14 @@
 package etcetera
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/coreos/go-etcd/etcd"
 )
@@ -47,7 +50,7 @@ func ExampleSave() {
 		return
 	}
 
-	if err := client.Save(); err != nil {
+	if err := client.Save(context.Background()); err != nil {
 		fmt.Println(err.Error())
 		return
 	}
@@ -80,7 +83,7 @@ func ExampleLoad() {
 		return
 	}
 
-	if err := client.Load(); err != nil {
+	if err := client.Load(context.Background()); err != nil {
 		fmt.Println(err.Error())
 		return
 	}
@@ -113,7 +116,7 @@ func ExampleWatch() {
 		return
 	}
 
-	_, err = client.Watch(a.Field1, func() {
+	_, err = client.Watch(context.Background(), a.Field1, func() {
 		fmt.Printf("%+v\n", a)
 	})
 
@@ -134,7 +137,7 @@ func TestNewClient(t *testing.T) {
 		machines    []string    // etcd servers
 		config      interface{} // configuration instance (structure) to save
 		expectedErr bool        // error expectation when building the object
-		expected    Client      // expected client object after calling the constructor
+		expected    *Client     // expected client object after calling the constructor
 	}{
 		{
 			description: "it should create a valid Client object",
@@ -144,12 +147,12 @@ func TestNewClient(t *testing.T) {
 				"http://127.0.0.1:4003",
 			},
 			config: &test,
-			expected: Client{
-				etcdClient: etcd.NewClient([]string{
+			expected: &Client{
+				backend: newV2Backend(newV2Client(etcd.NewClient([]string{
 					"http://127.0.0.1:4001",
 					"http://127.0.0.1:4002",
 					"http://127.0.0.1:4003",
-				}),
+				}))),
 				config: reflect.ValueOf(&test),
 				info: map[string]info{
 					"/":       info{field: reflect.ValueOf(&test).Elem()},
@@ -185,7 +188,7 @@ func TestNewClient(t *testing.T) {
 			continue
 		}
 
-		if !item.expectedErr && !equalClients(c, &item.expected) {
+		if !item.expectedErr && !equalClients(c, item.expected) {
 			t.Errorf("Item %d, “%s”: objects mismatch. Expecting “%+v”; found “%+v”",
 				i, item.description, item.expected, c)
 		}
@@ -746,6 +749,116 @@ func TestSave(t *testing.T) {
 			},
 			expectedErr: true,
 		},
+		{
+			description: "it should save unsigned integer and float fields",
+			config: &struct {
+				Field1 uint    `etcd:"/field1"`
+				Field2 float64 `etcd:"/field2"`
+			}{
+				Field1: 10,
+				Field2: 3.5,
+			},
+			expected: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key:   "/field1",
+						Value: "10",
+					},
+					{
+						Key:   "/field2",
+						Value: "3.5",
+					},
+				},
+			},
+		},
+		{
+			description: "it should save a field with a non-zero ttl option",
+			config: &struct {
+				Field string `etcd:"/field,ttl=30s"`
+			}{
+				Field: "value",
+			},
+			expected: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key:   "/field",
+						Value: "value",
+						TTL:   30,
+					},
+				},
+			},
+		},
+		{
+			description: "it should skip a nil pointer field, leaving the key absent",
+			config: &struct {
+				Field *string `etcd:"/field"`
+			}{},
+			expected: etcd.Node{
+				Dir: true,
+			},
+		},
+		{
+			description: "it should save the value pointed to by a non-nil pointer field",
+			config: &struct {
+				Field *string `etcd:"/field"`
+			}{
+				Field: func() *string { v := "value"; return &v }(),
+			},
+			expected: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key:   "/field",
+						Value: "value",
+					},
+				},
+			},
+		},
+		{
+			description: "it should save a time.Duration field using its string codec",
+			config: &struct {
+				Field time.Duration `etcd:"/field"`
+			}{
+				Field: 30 * time.Second,
+			},
+			expected: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key:   "/field",
+						Value: "30s",
+					},
+				},
+			},
+		},
+		{
+			description: "it should save a field through an explicitly selected codec",
+			config: &struct {
+				Field int `etcd:"/field,codec=json"`
+			}{
+				Field: 42,
+			},
+			expected: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key:   "/field",
+						Value: "42",
+					},
+				},
+			},
+		},
+		{
+			description: "it should skip an omitempty field holding its zero value",
+			config: &struct {
+				Field time.Duration `etcd:"/field,omitempty"`
+			}{},
+			expected: etcd.Node{
+				Dir: true,
+			},
+		},
 	}
 
 	for i, item := range data {
@@ -755,16 +868,17 @@ func TestSave(t *testing.T) {
 
 		mock := NewClientMock()
 		c := Client{
-			etcdClient: mock,
-			config:     reflect.ValueOf(item.config),
-			info:       make(map[string]info),
+			backend: newV2Backend(mock),
+			config:  reflect.ValueOf(item.config),
+			info:    make(map[string]info),
+			codecs:  defaultCodecs(),
 		}
 
 		if item.init != nil {
 			item.init(mock)
 		}
 
-		err := c.Save()
+		err := c.Save(context.Background())
 		if err == nil && item.expectedErr {
 			t.Errorf("Item %d, “%s”: error expected", i, item.description)
 			continue
@@ -784,22 +898,311 @@ func TestSave(t *testing.T) {
 func BenchmarkSave(b *testing.B) {
 	mock := NewClientMock()
 	c := Client{
-		etcdClient: mock,
+		backend: newV2Backend(mock),
 		config: reflect.ValueOf(struct {
 			Field string `etcd:"field"`
 		}{
 			Field: "value",
 		}),
-		info: make(map[string]info),
+		info:   make(map[string]info),
+		codecs: defaultCodecs(),
 	}
 
 	for i := 0; i < b.N; i++ {
-		if err := c.Save(); err != nil {
+		if err := c.Save(context.Background()); err != nil {
 			b.Fatal(err)
 		}
 	}
 }
 
+func TestSaveField(t *testing.T) {
+	data := []struct {
+		description string            // describe the test case
+		init        func(*clientMock) // initial configuration of the mocked client
+		info        info              // info entry tracked for the field, as left by a previous Load
+		field       interface{}       // field to save, addressed the same way Load/Watch expect
+		expectedErr error             // exact error expectation, nil meaning no error
+	}{
+		{
+			description: "it should save a field whose version still matches etcd",
+			init: func(c *clientMock) {
+				c.root.Nodes = append(c.root.Nodes, &etcd.Node{Key: "/field", Value: "old", ModifiedIndex: 1})
+			},
+			info:  info{version: 1, value: "old"},
+			field: new(string),
+		},
+		{
+			description: "it should fail with ErrStaleVersion when someone else changed the field",
+			init: func(c *clientMock) {
+				c.root.Nodes = append(c.root.Nodes, &etcd.Node{Key: "/field", Value: "changed", ModifiedIndex: 2})
+			},
+			info:        info{version: 1, value: "old"},
+			field:       new(string),
+			expectedErr: ErrStaleVersion{Path: "/field", HaveIndex: 1, WantIndex: 2},
+		},
+		{
+			description: "it should fail when the field wasn't previously loaded",
+			field:       new(string),
+			expectedErr: ErrFieldNotMapped,
+		},
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestSaveField for index %d\n", i)
+		}
+
+		mock := NewClientMock()
+		fieldValue := reflect.ValueOf(item.field).Elem()
+		fieldValue.SetString("new")
+
+		c := Client{
+			backend: newV2Backend(mock),
+			info:    make(map[string]info),
+			codecs:  defaultCodecs(),
+		}
+
+		if item.info.version != 0 || item.info.value != "" {
+			item.info.field = fieldValue
+			c.info["/field"] = item.info
+		}
+
+		if item.init != nil {
+			item.init(mock)
+		}
+
+		err := c.SaveField(context.Background(), item.field)
+		if item.expectedErr == nil && err != nil {
+			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err)
+
+		} else if item.expectedErr != nil && err != item.expectedErr {
+			t.Errorf("Item %d, “%s”: errors don't match. Expected “%v”; found “%v”", i, item.description, item.expectedErr, err)
+		}
+	}
+}
+
+func TestSaveFieldIf(t *testing.T) {
+	data := []struct {
+		description     string            // describe the test case
+		init            func(*clientMock) // initial configuration of the mocked client
+		info            info              // info entry tracked for the field, as left by a previous Load
+		field           interface{}       // field to save, addressed the same way Load/Watch expect
+		expectedVersion uint64            // version asserted against etcd, independent of info
+		expectedErr     error             // exact error expectation, nil meaning no error
+	}{
+		{
+			description: "it should save a field whose asserted version still matches etcd, ignoring a stale locally cached value",
+			init: func(c *clientMock) {
+				c.root.Nodes = append(c.root.Nodes, &etcd.Node{Key: "/field", Value: "changed elsewhere", ModifiedIndex: 1})
+			},
+			info:            info{version: 1, value: "old"},
+			field:           new(string),
+			expectedVersion: 1,
+		},
+		{
+			description: "it should fail with ErrStaleVersion when the asserted version no longer matches etcd",
+			init: func(c *clientMock) {
+				c.root.Nodes = append(c.root.Nodes, &etcd.Node{Key: "/field", Value: "old", ModifiedIndex: 2})
+			},
+			info:            info{version: 1, value: "old"},
+			field:           new(string),
+			expectedVersion: 1,
+			expectedErr:     ErrStaleVersion{Path: "/field", HaveIndex: 1, WantIndex: 2},
+		},
+		{
+			description:     "it should fail when the field wasn't previously loaded",
+			field:           new(string),
+			expectedVersion: 1,
+			expectedErr:     ErrFieldNotMapped,
+		},
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestSaveFieldIf for index %d\n", i)
+		}
+
+		mock := NewClientMock()
+		fieldValue := reflect.ValueOf(item.field).Elem()
+		fieldValue.SetString("new")
+
+		c := Client{
+			backend: newV2Backend(mock),
+			info:    make(map[string]info),
+			codecs:  defaultCodecs(),
+		}
+
+		if item.info.version != 0 || item.info.value != "" {
+			item.info.field = fieldValue
+			c.info["/field"] = item.info
+		}
+
+		if item.init != nil {
+			item.init(mock)
+		}
+
+		err := c.SaveFieldIf(context.Background(), item.field, item.expectedVersion)
+		if item.expectedErr == nil && err != nil {
+			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err)
+
+		} else if item.expectedErr != nil && err != item.expectedErr {
+			t.Errorf("Item %d, “%s”: errors don't match. Expected “%v”; found “%v”", i, item.description, item.expectedErr, err)
+		}
+	}
+}
+
+func TestSaveCAS(t *testing.T) {
+	data := []struct {
+		description string                 // describe the test case
+		init        func(*clientMock)      // initial configuration of the mocked client
+		info        map[string]interface{} // path to pointer of the tracked field's current value
+		expectedErr bool                   // error expectation when saving the configuration
+	}{
+		{
+			description: "it should save every scalar field whose version still matches etcd",
+			init: func(c *clientMock) {
+				c.root.Nodes = append(c.root.Nodes,
+					&etcd.Node{Key: "/field1", Value: "old1", ModifiedIndex: 1},
+					&etcd.Node{Key: "/field2", Value: "10", ModifiedIndex: 1},
+				)
+			},
+			info: map[string]interface{}{
+				"/field1": new(string),
+				"/field2": new(int),
+			},
+		},
+		{
+			description: "it should stop at the first stale field",
+			init: func(c *clientMock) {
+				c.root.Nodes = append(c.root.Nodes, &etcd.Node{Key: "/field1", Value: "changed", ModifiedIndex: 2})
+			},
+			info: map[string]interface{}{
+				"/field1": new(string),
+			},
+			expectedErr: true,
+		},
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestSaveCAS for index %d\n", i)
+		}
+
+		mock := NewClientMock()
+		c := Client{
+			backend: newV2Backend(mock),
+			info:    make(map[string]info),
+			codecs:  defaultCodecs(),
+		}
+
+		for path, field := range item.info {
+			fieldValue := reflect.ValueOf(field).Elem()
+
+			switch fieldValue.Kind() {
+			case reflect.String:
+				fieldValue.SetString("new")
+				c.info[path] = info{field: fieldValue, version: 1, value: "old1"}
+
+			case reflect.Int:
+				fieldValue.SetInt(20)
+				c.info[path] = info{field: fieldValue, version: 1, value: "10"}
+			}
+		}
+
+		if item.init != nil {
+			item.init(mock)
+		}
+
+		err := c.SaveCAS(context.Background())
+		if err == nil && item.expectedErr {
+			t.Errorf("Item %d, “%s”: error expected", i, item.description)
+
+		} else if err != nil && !item.expectedErr {
+			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err)
+		}
+	}
+}
+
+func TestDeleteCAS(t *testing.T) {
+	data := []struct {
+		description string            // describe the test case
+		init        func(*clientMock) // initial configuration of the mocked client
+		info        info              // info entry tracked for the field, as left by a previous Load
+		field       interface{}       // field to delete, addressed the same way Load/Watch expect
+		expectedErr error             // exact error expectation, nil meaning no error
+	}{
+		{
+			description: "it should delete a field whose version still matches etcd",
+			init: func(c *clientMock) {
+				c.root.Nodes = append(c.root.Nodes, &etcd.Node{Key: "/field", Value: "old", ModifiedIndex: 1})
+			},
+			info:  info{version: 1, value: "old"},
+			field: new(string),
+		},
+		{
+			description: "it should fail with ErrStaleVersion when someone else changed the index",
+			init: func(c *clientMock) {
+				c.root.Nodes = append(c.root.Nodes, &etcd.Node{Key: "/field", Value: "old", ModifiedIndex: 2})
+			},
+			info:        info{version: 1, value: "old"},
+			field:       new(string),
+			expectedErr: ErrStaleVersion{Path: "/field", HaveIndex: 1, WantIndex: 2},
+		},
+		{
+			description: "it should fail with ErrStaleVersion when someone else changed the value",
+			init: func(c *clientMock) {
+				c.root.Nodes = append(c.root.Nodes, &etcd.Node{Key: "/field", Value: "changed", ModifiedIndex: 1})
+			},
+			info:        info{version: 1, value: "old"},
+			field:       new(string),
+			expectedErr: ErrStaleVersion{Path: "/field", HaveIndex: 1, WantIndex: 1},
+		},
+		{
+			description: "it should fail when the key no longer exists in etcd",
+			info:        info{version: 1, value: "old"},
+			field:       new(string),
+			expectedErr: &etcd.EtcdError{ErrorCode: int(etcdErrorCodeKeyNotFound), Message: "/field"},
+		},
+		{
+			description: "it should fail when the field wasn't previously loaded",
+			field:       new(string),
+			expectedErr: ErrFieldNotMapped,
+		},
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestDeleteCAS for index %d\n", i)
+		}
+
+		mock := NewClientMock()
+		fieldValue := reflect.ValueOf(item.field).Elem()
+
+		c := Client{
+			backend: newV2Backend(mock),
+			info:    make(map[string]info),
+			codecs:  defaultCodecs(),
+		}
+
+		if item.info.version != 0 || item.info.value != "" {
+			item.info.field = fieldValue
+			c.info["/field"] = item.info
+		}
+
+		if item.init != nil {
+			item.init(mock)
+		}
+
+		err := c.DeleteCAS(context.Background(), item.field)
+		if item.expectedErr == nil && err != nil {
+			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err)
+
+		} else if item.expectedErr != nil && !reflect.DeepEqual(err, item.expectedErr) {
+			t.Errorf("Item %d, “%s”: errors don't match. Expected “%v”; found “%v”", i, item.description, item.expectedErr, err)
+		}
+	}
+}
+
 func TestLoad(t *testing.T) {
 	data := []struct {
 		description string            // describe the test case
@@ -1420,78 +1823,427 @@ func TestLoad(t *testing.T) {
 				c.getErrors["/field"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
 			},
 			config: &struct {
-				Field map[string]string `etcd:"/field"`
+				Field map[string]string `etcd:"/field"`
+			}{
+				Field: make(map[string]string),
+			},
+			expectedErr: true,
+		},
+		{
+			description: "it should fail when etcd data is corrupted",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key: "/field",
+						Dir: true,
+						Nodes: etcd.Nodes{
+							{
+								Key: "/field/subfield",
+								Dir: true,
+								Nodes: etcd.Nodes{
+									{
+										Key:   "/field/subfield/subsubfield2",
+										Value: "NaN",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			config: &struct {
+				Field struct {
+					Subfield struct {
+						Subsubfield1 string
+						Subsubfield2 int `etcd:"/subsubfield2"`
+					} `etcd:"/subfield"`
+				} `etcd:"/field"`
+			}{},
+			expectedErr: true,
+		},
+		{
+			description: "it should load unsigned integer and float fields",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key:   "/field1",
+						Value: "10",
+					},
+					{
+						Key:   "/field2",
+						Value: "3.5",
+					},
+				},
+			},
+			config: &struct {
+				Field1 uint    `etcd:"/field1"`
+				Field2 float64 `etcd:"/field2"`
+			}{},
+			expected: struct {
+				Field1 uint    `etcd:"/field1"`
+				Field2 float64 `etcd:"/field2"`
+			}{
+				Field1: 10,
+				Field2: 3.5,
+			},
+		},
+		{
+			description: "it should leave a pointer field nil when the key is absent in etcd",
+			etcdData: etcd.Node{
+				Dir: true,
+			},
+			config: &struct {
+				Field *string `etcd:"/field"`
+			}{},
+			expected: struct {
+				Field *string `etcd:"/field"`
+			}{},
+		},
+		{
+			description: "it should allocate and fill a pointer field present in etcd",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key:   "/field",
+						Value: "value",
+					},
+				},
+			},
+			config: &struct {
+				Field *string `etcd:"/field"`
+			}{},
+			expected: struct {
+				Field *string `etcd:"/field"`
+			}{
+				Field: func() *string { v := "value"; return &v }(),
+			},
+		},
+		{
+			description: "it should load a time.Duration field using its string codec",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key:   "/field",
+						Value: "30s",
+					},
+				},
+			},
+			config: &struct {
+				Field time.Duration `etcd:"/field"`
+			}{},
+			expected: struct {
+				Field time.Duration `etcd:"/field"`
+			}{
+				Field: 30 * time.Second,
+			},
+		},
+		{
+			description: "it should load a field through an explicitly selected codec",
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key:   "/field",
+						Value: "42",
+					},
+				},
+			},
+			config: &struct {
+				Field int `etcd:"/field,codec=json"`
+			}{},
+			expected: struct {
+				Field int `etcd:"/field,codec=json"`
+			}{
+				Field: 42,
+			},
+		},
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestLoad for index %d\n", i)
+		}
+
+		mock := NewClientMock()
+		mock.root = &item.etcdData
+
+		c := Client{
+			backend: newV2Backend(mock),
+			config:  reflect.ValueOf(item.config),
+			info:    make(map[string]info),
+			codecs:  defaultCodecs(),
+		}
+
+		if item.init != nil {
+			item.init(mock)
+		}
+
+		err := c.Load(context.Background())
+		if err == nil && item.expectedErr {
+			t.Errorf("Item %d, “%s”: error expected", i, item.description)
+			continue
+
+		} else if err != nil && !item.expectedErr {
+			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err.Error())
+			continue
+		}
+
+		if !item.expectedErr && reflect.DeepEqual(item.config, item.expected) {
+			t.Errorf("Item %d, “%s”: config mismatch. Expecting “%+v”; found “%+v”",
+				i, item.description, item.expected, item.config)
+		}
+	}
+}
+
+// roleProvider is a test-only AuthProvider that always reports the given roles for UserFor.
+type roleProvider struct {
+	roles []string
+	err   error
+}
+
+func (p roleProvider) UserFor(ctx context.Context) (string, []string, error) {
+	return "test-user", p.roles, p.err
+}
+
+func TestLoadACL(t *testing.T) {
+	data := []struct {
+		description string       // describe the test case
+		auth        AuthProvider // caller roles resolved via WithAuth
+		etcdData    etcd.Node    // etcd state before loading the configuration
+		config      interface{}  // configuration structure (used to detect what we need to look for in etcd)
+		expectedErr error        // exact error expectation, nil meaning no error
+		expected    interface{}  // configuration instance expected after loading
+	}{
+		{
+			description: "it should load a field with no acl option regardless of the caller's roles",
+			auth:        roleProvider{},
+			etcdData: etcd.Node{
+				Dir:   true,
+				Nodes: etcd.Nodes{{Key: "/field", Value: "value"}},
+			},
+			config: &struct {
+				Field string `etcd:"/field"`
+			}{},
+			expected: struct {
+				Field string `etcd:"/field"`
+			}{
+				Field: "value",
+			},
+		},
+		{
+			description: "it should load an acl-tagged field when the caller holds the role",
+			auth:        roleProvider{roles: []string{"admin"}},
+			etcdData: etcd.Node{
+				Dir:   true,
+				Nodes: etcd.Nodes{{Key: "/field", Value: "value"}},
+			},
+			config: &struct {
+				Field string `etcd:"/field,acl=admin"`
+			}{},
+			expected: struct {
+				Field string `etcd:"/field,acl=admin"`
+			}{
+				Field: "value",
+			},
+		},
+		{
+			description: "it should skip an acl-tagged field the caller doesn't hold the role for and report PartialLoadError",
+			auth:        roleProvider{roles: []string{"guest"}},
+			etcdData: etcd.Node{
+				Dir:   true,
+				Nodes: etcd.Nodes{{Key: "/field", Value: "value"}},
+			},
+			config: &struct {
+				Field string `etcd:"/field,acl=admin"`
+			}{},
+			expectedErr: PartialLoadError{Skipped: []string{"/field"}},
+			expected: struct {
+				Field string `etcd:"/field,acl=admin"`
+			}{},
+		},
+		{
+			description: "it should skip an acl-tagged nested field the same way as a top-level one",
+			auth:        roleProvider{roles: []string{"guest"}},
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{
+						Key:   "/field",
+						Dir:   true,
+						Nodes: etcd.Nodes{{Key: "/field/subfield", Value: "value"}},
+					},
+				},
+			},
+			config: &struct {
+				Field struct {
+					Subfield string `etcd:"/subfield,acl=admin"`
+				} `etcd:"/field"`
+			}{},
+			expectedErr: PartialLoadError{Skipped: []string{"/field/subfield"}},
+			expected: struct {
+				Field struct {
+					Subfield string `etcd:"/subfield,acl=admin"`
+				} `etcd:"/field"`
+			}{},
+		},
+	}
+
+	for i, item := range data {
+		if DEBUG {
+			fmt.Printf(">>> Running TestLoadACL for index %d\n", i)
+		}
+
+		mock := NewClientMock()
+		mock.root = &item.etcdData
+
+		c := Client{
+			backend: newV2Backend(mock),
+			config:  reflect.ValueOf(item.config),
+			info:    make(map[string]info),
+			codecs:  defaultCodecs(),
+			auth:    item.auth,
+		}
+
+		err := c.Load(context.Background())
+		if item.expectedErr == nil && err != nil {
+			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err)
+			continue
+
+		} else if item.expectedErr != nil && !reflect.DeepEqual(err, item.expectedErr) {
+			t.Errorf("Item %d, “%s”: errors don't match. Expected “%v”; found “%v”", i, item.description, item.expectedErr, err)
+			continue
+		}
+
+		if got := reflect.ValueOf(item.config).Elem().Interface(); !reflect.DeepEqual(got, item.expected) {
+			t.Errorf("Item %d, “%s”: config mismatch. Expecting “%+v”; found “%+v”",
+				i, item.description, item.expected, got)
+		}
+	}
+}
+
+func TestLoadHiddenPolicy(t *testing.T) {
+	data := []struct {
+		description  string       // describe the test case
+		hiddenPolicy HiddenPolicy // policy the Client loads under
+		etcdData     etcd.Node    // etcd state before loading the configuration
+		config       interface{}  // configuration structure (used to detect what we need to look for in etcd)
+		expected     interface{}  // configuration instance expected after loading
+	}{
+		{
+			description:  "it should skip a \"_\"-prefixed field under the default HideHidden policy",
+			hiddenPolicy: HideHidden,
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{Key: "/field", Value: "visible"},
+					{Key: "/_internal", Value: "hidden"},
+				},
+			},
+			config: &struct {
+				Field    string `etcd:"/field"`
+				Internal string `etcd:"/_internal"`
+			}{},
+			expected: struct {
+				Field    string `etcd:"/field"`
+				Internal string `etcd:"/_internal"`
+			}{
+				Field: "visible",
+			},
+		},
+		{
+			description:  "it should load both under ShowHidden",
+			hiddenPolicy: ShowHidden,
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{Key: "/field", Value: "visible"},
+					{Key: "/_internal", Value: "hidden"},
+				},
+			},
+			config: &struct {
+				Field    string `etcd:"/field"`
+				Internal string `etcd:"/_internal"`
+			}{},
+			expected: struct {
+				Field    string `etcd:"/field"`
+				Internal string `etcd:"/_internal"`
+			}{
+				Field:    "visible",
+				Internal: "hidden",
+			},
+		},
+		{
+			description:  "it should skip the visible field and load only the hidden one under OnlyHidden",
+			hiddenPolicy: OnlyHidden,
+			etcdData: etcd.Node{
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{Key: "/field", Value: "visible"},
+					{Key: "/_internal", Value: "hidden"},
+				},
+			},
+			config: &struct {
+				Field    string `etcd:"/field"`
+				Internal string `etcd:"/_internal"`
+			}{},
+			expected: struct {
+				Field    string `etcd:"/field"`
+				Internal string `etcd:"/_internal"`
 			}{
-				Field: make(map[string]string),
+				Internal: "hidden",
 			},
-			expectedErr: true,
 		},
 		{
-			description: "it should fail when etcd data is corrupted",
+			description:  "it should treat a \"hidden\"-tagged field as hidden even without a \"_\" prefix",
+			hiddenPolicy: HideHidden,
 			etcdData: etcd.Node{
 				Dir: true,
 				Nodes: etcd.Nodes{
-					{
-						Key: "/field",
-						Dir: true,
-						Nodes: etcd.Nodes{
-							{
-								Key: "/field/subfield",
-								Dir: true,
-								Nodes: etcd.Nodes{
-									{
-										Key:   "/field/subfield/subsubfield2",
-										Value: "NaN",
-									},
-								},
-							},
-						},
-					},
+					{Key: "/field", Value: "visible"},
+					{Key: "/bookkeeping", Value: "hidden"},
 				},
 			},
 			config: &struct {
-				Field struct {
-					Subfield struct {
-						Subsubfield1 string
-						Subsubfield2 int `etcd:"/subsubfield2"`
-					} `etcd:"/subfield"`
-				} `etcd:"/field"`
+				Field       string `etcd:"/field"`
+				Bookkeeping string `etcd:"/bookkeeping,hidden"`
 			}{},
-			expectedErr: true,
+			expected: struct {
+				Field       string `etcd:"/field"`
+				Bookkeeping string `etcd:"/bookkeeping,hidden"`
+			}{
+				Field: "visible",
+			},
 		},
 	}
 
 	for i, item := range data {
 		if DEBUG {
-			fmt.Printf(">>> Running TestLoad for index %d\n", i)
+			fmt.Printf(">>> Running TestLoadHiddenPolicy for index %d\n", i)
 		}
 
 		mock := NewClientMock()
 		mock.root = &item.etcdData
 
 		c := Client{
-			etcdClient: mock,
-			config:     reflect.ValueOf(item.config),
-			info:       make(map[string]info),
-		}
-
-		if item.init != nil {
-			item.init(mock)
+			backend:      newV2Backend(mock),
+			config:       reflect.ValueOf(item.config),
+			info:         make(map[string]info),
+			codecs:       defaultCodecs(),
+			hiddenPolicy: item.hiddenPolicy,
 		}
 
-		err := c.Load()
-		if err == nil && item.expectedErr {
-			t.Errorf("Item %d, “%s”: error expected", i, item.description)
-			continue
-
-		} else if err != nil && !item.expectedErr {
-			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err.Error())
+		if err := c.Load(context.Background()); err != nil {
+			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err)
 			continue
 		}
 
-		if !item.expectedErr && reflect.DeepEqual(item.config, item.expected) {
+		if got := reflect.ValueOf(item.config).Elem().Interface(); !reflect.DeepEqual(got, item.expected) {
 			t.Errorf("Item %d, “%s”: config mismatch. Expecting “%+v”; found “%+v”",
-				i, item.description, item.expected, item.config)
+				i, item.description, item.expected, got)
 		}
 	}
 }
@@ -1509,15 +2261,16 @@ func BenchmarkLoad(b *testing.B) {
 	}
 
 	c := Client{
-		etcdClient: mock,
+		backend: newV2Backend(mock),
 		config: reflect.ValueOf(&struct {
 			Field string `etcd:"field"`
 		}{}),
-		info: make(map[string]info),
+		info:   make(map[string]info),
+		codecs: defaultCodecs(),
 	}
 
 	for i := 0; i < b.N; i++ {
-		if err := c.Load(); err != nil {
+		if err := c.Load(context.Background()); err != nil {
 			b.Fatal(err)
 		}
 	}
@@ -1832,19 +2585,20 @@ func TestWatch(t *testing.T) {
 		mock.root = &etcdData
 
 		c := Client{
-			etcdClient: mock,
-			config:     reflect.ValueOf(&config),
-			info:       make(map[string]info),
+			backend: newV2Backend(mock),
+			config:  reflect.ValueOf(&config),
+			info:    make(map[string]info),
+			codecs:  defaultCodecs(),
 		}
 
 		if item.init != nil {
 			item.init(mock)
 		}
 
-		c.preload(c.config, "")
+		c.preload(c.config, "", "")
 
 		done := make(chan bool)
-		stop, err := c.Watch(item.field, func() {
+		stop, err := c.Watch(context.Background(), item.field, func() {
 			done <- true
 		})
 
@@ -1877,6 +2631,74 @@ func TestWatch(t *testing.T) {
 	}
 }
 
+func TestWatchDebounced(t *testing.T) {
+	config := struct {
+		Field []string `etcd:"/field"`
+	}{}
+
+	mock := NewClientMock()
+	mock.root = &etcd.Node{
+		Dir: true,
+		Nodes: etcd.Nodes{
+			{
+				Key: "/field",
+				Dir: true,
+				Nodes: etcd.Nodes{
+					{Key: "/field/0", Value: "a"},
+					{Key: "/field/1", Value: "b"},
+				},
+			},
+		},
+	}
+
+	c := Client{
+		backend: newV2Backend(mock),
+		config:  reflect.ValueOf(&config),
+		info:    make(map[string]info),
+		codecs:  defaultCodecs(),
+	}
+
+	c.preload(c.config, "", "")
+
+	called := make(chan uint64, 10)
+	stop, err := c.WatchDebounced(context.Background(), &config.Field, 50*time.Millisecond, func(revision uint64) {
+		called <- revision
+	})
+	if err != nil {
+		t.Fatalf("unexpected error watching the field: %s", err)
+	}
+	defer close(stop)
+
+	// Three changes land close together; they should coalesce into a single callback instead of
+	// three, each reloading the field from whatever is in mock.root at the time it fires
+	mock.notifyChange(etcd.Node{Nodes: etcd.Nodes{{Key: "/field/0", Value: "c"}, {Key: "/field/1", Value: "b"}}})
+	mock.notifyChange(etcd.Node{Nodes: etcd.Nodes{{Key: "/field/0", Value: "c"}, {Key: "/field/1", Value: "d"}}})
+	// Watch already applies each notified node onto the shared mock tree (see clientMock.Watch), so
+	// the Get the debounced callback issues once the burst settles sees this value without the test
+	// goroutine touching mock.root itself
+	mock.notifyChange(etcd.Node{Nodes: etcd.Nodes{{Key: "/field/0", Value: "c"}, {Key: "/field/1", Value: "d"}}})
+
+	select {
+	case revision := <-called:
+		if revision == 0 {
+			t.Errorf("expected a non-zero revision, found 0")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the debounced callback")
+	}
+
+	select {
+	case <-called:
+		t.Fatal("debounced callback fired more than once for a single coalesced burst")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	expected := []string{"c", "d"}
+	if !reflect.DeepEqual(config.Field, expected) {
+		t.Errorf("fields mismatch. Expecting “%+v”; found “%+v”", expected, config.Field)
+	}
+}
+
 func BenchmarkWatch(b *testing.B) {
 	mock := NewClientMock()
 	mock.root = &etcd.Node{
@@ -1894,16 +2716,17 @@ func BenchmarkWatch(b *testing.B) {
 	}{}
 
 	c := Client{
-		etcdClient: mock,
-		config:     reflect.ValueOf(&s),
-		info:       make(map[string]info),
+		backend: newV2Backend(mock),
+		config:  reflect.ValueOf(&s),
+		info:    make(map[string]info),
+		codecs:  defaultCodecs(),
 	}
 
-	c.preload(c.config, "")
+	c.preload(c.config, "", "")
 
 	called := make(chan bool)
 	for i := 0; i < b.N; i++ {
-		stop, err := c.Watch(&s.Field, func() {
+		stop, err := c.Watch(context.Background(), &s.Field, func() {
 			called <- true
 		})
 
@@ -1926,10 +2749,22 @@ func BenchmarkWatch(b *testing.B) {
 //////////////////////////////////////
 //////////////////////////////////////
 
+// mockChange is what notifyChange sends clientMock.Watch through the change channel: node is the
+// etcd.Node state to apply, and action is the etcd action to report (e.g. "set", "delete"), used
+// for a recursive watch rooted above the changed key (see Events/WatchAll) where the action can't
+// be inferred from diffing the watched node's own state
+type mockChange struct {
+	node   etcd.Node
+	action string
+}
+
 type clientMock struct {
-	root      *etcd.Node     // root node
-	etcdIndex uint64         // control update sequence
-	change    chan etcd.Node // simulate config changes for watch
+	// mu guards root and etcdIndex against concurrent access between a test goroutine calling
+	// notifyChange or one of the CRUD methods and a Watch goroutine still looping in the background
+	mu        sync.Mutex
+	root      *etcd.Node      // root node
+	etcdIndex uint64          // control update sequence
+	change    chan mockChange // simulate config changes for watch
 
 	// force errors for specific methods and paths
 	createDirErrors     map[string]error
@@ -1937,6 +2772,10 @@ type clientMock struct {
 	setErrors           map[string]error
 	getErrors           map[string]error
 	watchErrors         map[string]error
+
+	// members, when set, is returned as-is by Members, letting tests drive HealthCheck's detection
+	// logic with whatever per-machine reachability, cluster ID and member list they need
+	members []MemberHealth
 }
 
 func NewClientMock() *clientMock {
@@ -1944,7 +2783,7 @@ func NewClientMock() *clientMock {
 		root: &etcd.Node{
 			Dir: true,
 		},
-		change:              make(chan etcd.Node),
+		change:              make(chan mockChange),
 		createDirErrors:     make(map[string]error),
 		createInOrderErrors: make(map[string]error),
 		setErrors:           make(map[string]error),
@@ -2002,6 +2841,41 @@ func (c *clientMock) CreateDir(path string, ttl uint64) (*etcd.Response, error)
 	}, err
 }
 
+func (c *clientMock) Create(path, value string, ttl uint64) (*etcd.Response, error) {
+	if DEBUG {
+		fmt.Printf(" - Creating path %s with value “%s”\n", path, value)
+	}
+
+	if err := c.setErrors[path]; err != nil {
+		return nil, err
+	}
+
+	parent := c.createDirsInPath(path, 0)
+
+	for _, n := range parent.Nodes {
+		if n.Key == path {
+			return nil, &etcd.EtcdError{ErrorCode: int(etcdErrorCodeNodeExist), Message: path}
+		}
+	}
+
+	c.etcdIndex++
+
+	newNode := &etcd.Node{
+		Key:           path,
+		Value:         value,
+		TTL:           int64(ttl),
+		ModifiedIndex: c.etcdIndex,
+		CreatedIndex:  c.etcdIndex,
+	}
+	parent.Nodes = append(parent.Nodes, newNode)
+
+	return &etcd.Response{
+		Action:    "create",
+		Node:      newNode,
+		EtcdIndex: c.etcdIndex,
+	}, nil
+}
+
 func (c *clientMock) CreateInOrder(path string, value string, ttl uint64) (*etcd.Response, error) {
 	if DEBUG {
 		fmt.Printf(" - Creating in order path %s with value “%s”\n", path, value)
@@ -2118,6 +2992,9 @@ func (c *clientMock) Get(path string, sort, recursive bool) (*etcd.Response, err
 		return nil, err
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	current := c.root
 	currentPath := c.root.Key
 	parts := strings.Split(path, "/")
@@ -2147,19 +3024,60 @@ func (c *clientMock) Get(path string, sort, recursive bool) (*etcd.Response, err
 	}, nil
 }
 
-func (c *clientMock) Watch(
-	path string,
-	waitIndex uint64,
-	recursive bool,
-	receiver chan *etcd.Response,
-	stop chan bool,
-) (*etcd.Response, error) {
+func (c *clientMock) Delete(path string, recursive bool) (*etcd.Response, error) {
+	if DEBUG {
+		fmt.Printf(" - Deleting path %s\n", path)
+	}
+
+	parts := strings.Split(path, "/")
+
+	parent := c.root
+	currentPath := c.root.Key
+
+	for i := 1; i < len(parts)-1; i++ {
+		currentPath += "/" + parts[i]
+
+		found := false
+		for _, n := range parent.Nodes {
+			if n.Key == currentPath {
+				found = true
+				parent = n
+				break
+			}
+		}
+
+		if !found {
+			return nil, &etcd.EtcdError{ErrorCode: int(etcdErrorCodeKeyNotFound), Message: path}
+		}
+	}
+
+	c.etcdIndex++
+
+	for i, n := range parent.Nodes {
+		if n.Key == path {
+			if n.Dir && len(n.Nodes) > 0 && !recursive {
+				return nil, &etcd.EtcdError{ErrorCode: int(etcdErrorCodeNotFile), Message: path}
+			}
+
+			parent.Nodes = append(parent.Nodes[:i], parent.Nodes[i+1:]...)
+
+			return &etcd.Response{
+				Action:    "delete",
+				Node:      n,
+				EtcdIndex: c.etcdIndex,
+			}, nil
+		}
+	}
+
+	return nil, &etcd.EtcdError{ErrorCode: int(etcdErrorCodeKeyNotFound), Message: path}
+}
 
+func (c *clientMock) CompareAndSwap(path, value string, ttl uint64, prevValue string, prevIndex uint64) (*etcd.Response, error) {
 	if DEBUG {
-		fmt.Printf(" - Watching path %s\n", path)
+		fmt.Printf(" - Comparing and swapping path %s with value “%s”\n", path, value)
 	}
 
-	if err := c.watchErrors[path]; err != nil {
+	if err := c.setErrors[path]; err != nil {
 		return nil, err
 	}
 
@@ -2168,8 +3086,7 @@ func (c *clientMock) Watch(
 	parts := strings.Split(path, "/")
 
 	for i := 1; i < len(parts); i++ {
-		part := parts[i]
-		currentPath += "/" + part
+		currentPath += "/" + parts[i]
 
 		found := false
 		for _, n := range current.Nodes {
@@ -2185,20 +3102,167 @@ func (c *clientMock) Watch(
 		}
 	}
 
-	select {
-	case node := <-c.change:
-		current.Value = node.Value
-		current.Nodes = node.Nodes
+	if (prevValue != "" && current.Value != prevValue) ||
+		(prevIndex != 0 && current.ModifiedIndex != prevIndex) {
+
+		return nil, &etcd.EtcdError{ErrorCode: int(etcdErrorCodeTestFailed), Message: path, Index: current.ModifiedIndex}
+	}
+
+	c.etcdIndex++
+
+	oldNode := new(etcd.Node)
+	*oldNode = *current
+
+	current.Value = value
+	current.TTL = int64(ttl)
+	current.ModifiedIndex = c.etcdIndex
+
+	return &etcd.Response{
+		Action:    "compareAndSwap",
+		Node:      current,
+		PrevNode:  oldNode,
+		EtcdIndex: c.etcdIndex,
+	}, nil
+}
+
+func (c *clientMock) CompareAndDelete(path, prevValue string, prevIndex uint64) (*etcd.Response, error) {
+	if DEBUG {
+		fmt.Printf(" - Comparing and deleting path %s\n", path)
+	}
+
+	parts := strings.Split(path, "/")
+
+	parent := c.root
+	currentPath := c.root.Key
+
+	for i := 1; i < len(parts)-1; i++ {
+		currentPath += "/" + parts[i]
+
+		found := false
+		for _, n := range parent.Nodes {
+			if n.Key == currentPath {
+				found = true
+				parent = n
+				break
+			}
+		}
+
+		if !found {
+			return nil, &etcd.EtcdError{ErrorCode: int(etcdErrorCodeKeyNotFound), Message: path}
+		}
+	}
+
+	for i, n := range parent.Nodes {
+		if n.Key != path {
+			continue
+		}
+
+		if (prevValue != "" && n.Value != prevValue) ||
+			(prevIndex != 0 && n.ModifiedIndex != prevIndex) {
+
+			return nil, &etcd.EtcdError{ErrorCode: int(etcdErrorCodeTestFailed), Message: path, Index: n.ModifiedIndex}
+		}
+
+		c.etcdIndex++
+		parent.Nodes = append(parent.Nodes[:i], parent.Nodes[i+1:]...)
 
-		receiver <- &etcd.Response{
-			Action:    "get",
-			Node:      current,
+		return &etcd.Response{
+			Action:    "compareAndDelete",
+			Node:      n,
 			EtcdIndex: c.etcdIndex,
+		}, nil
+	}
+
+	return nil, &etcd.EtcdError{ErrorCode: int(etcdErrorCodeKeyNotFound), Message: path}
+}
+
+func (c *clientMock) Members() []MemberHealth {
+	return c.members
+}
+
+func (c *clientMock) Watch(
+	path string,
+	waitIndex uint64,
+	recursive bool,
+	receiver chan *etcd.Response,
+	stop chan bool,
+) (*etcd.Response, error) {
+
+	if DEBUG {
+		fmt.Printf(" - Watching path %s\n", path)
+	}
+
+	if err := c.watchErrors[path]; err != nil {
+		return nil, err
+	}
+
+	current := c.root
+	currentPath := c.root.Key
+	parts := strings.Split(path, "/")
+
+	// A watch rooted at "/" (Events, WatchAll) has nothing to navigate to: the root node itself
+	// is already what's being watched, and its descendants change independently of it
+	if path != "/" {
+		for i := 1; i < len(parts); i++ {
+			part := parts[i]
+			currentPath += "/" + part
+
+			found := false
+			for _, n := range current.Nodes {
+				if n.Key == currentPath {
+					found = true
+					current = n
+					break
+				}
+			}
+
+			if !found {
+				return nil, &etcd.EtcdError{ErrorCode: int(etcdErrorCodeKeyNotFound), Message: path}
+			}
 		}
-	case <-stop:
 	}
 
-	return nil, nil
+	// Loops the same way the real go-etcd client does when given a receiver channel, delivering
+	// every change until stop fires instead of returning after the first one
+	for {
+		select {
+		case change := <-c.change:
+			node := change.node
+
+			c.mu.Lock()
+			etcdIndex := c.etcdIndex
+
+			var sent etcd.Node
+			action := "get"
+
+			if len(node.Key) > 0 && node.Key != current.Key {
+				// A recursive watch rooted above the changed key (see Events/WatchAll): the
+				// notified node already carries its own key, so it is delivered as-is instead of
+				// folding into the single watched node's state
+				sent = node
+				if len(change.action) > 0 {
+					action = change.action
+				}
+			} else {
+				current.Value = node.Value
+				current.Nodes = node.Nodes
+				current.ModifiedIndex = node.ModifiedIndex
+				// A copy is sent downstream instead of current itself, since current keeps being
+				// mutated in place by later events on this same loop while a previous response is
+				// still being read by whatever is forwarding it (see forwardEtcdResponses)
+				sent = *current
+			}
+			c.mu.Unlock()
+
+			receiver <- &etcd.Response{
+				Action:    action,
+				Node:      &sent,
+				EtcdIndex: etcdIndex,
+			}
+		case <-stop:
+			return nil, nil
+		}
+	}
 }
 
 func (c *clientMock) createDirsInPath(path string, ttl uint64) *etcd.Node {
@@ -2249,16 +3313,29 @@ func (c *clientMock) createDirsInPath(path string, ttl uint64) *etcd.Node {
 }
 
 func (c *clientMock) notifyChange(node etcd.Node) {
+	c.mu.Lock()
 	c.etcdIndex++
 	node.ModifiedIndex = c.etcdIndex
+	c.mu.Unlock()
 	// TODO: Modify all children nodes versions
-	c.change <- node
+	c.change <- mockChange{node: node}
+}
+
+// notifyChangeWithAction is notifyChange's counterpart for a recursive watch rooted above the
+// changed key (see Events/WatchAll tests): node.Key identifies exactly which descendant changed,
+// and action is reported as-is instead of the "get" default notifyChange's caller relies on
+func (c *clientMock) notifyChangeWithAction(node etcd.Node, action string) {
+	c.mu.Lock()
+	c.etcdIndex++
+	node.ModifiedIndex = c.etcdIndex
+	c.mu.Unlock()
+	c.change <- mockChange{node: node, action: action}
 }
 
 func equalClients(c1, c2 *Client) bool {
 	if c1.config != c2.config ||
-		(c1.etcdClient == nil && c2.etcdClient != nil) ||
-		(c1.etcdClient != nil && c2.etcdClient == nil) {
+		(c1.backend == nil && c2.backend != nil) ||
+		(c1.backend != nil && c2.backend == nil) {
 
 		return false
 	}
@@ -2298,56 +3375,35 @@ func equalClients(c1, c2 *Client) bool {
 }
 
 func equalNodes(n1, n2 *etcd.Node) bool {
-	if n1.Key != n2.Key ||
-		n1.Value != n2.Value ||
-		n1.Dir != n2.Dir ||
-		n1.TTL != n2.TTL ||
-		len(n1.Nodes) != len(n2.Nodes) {
-
-		return false
-	}
-
-	// Children are not ordered
-	for _, c1 := range n1.Nodes {
-		foundEqual := false
-		for _, c2 := range n2.Nodes {
-			if equalNodes(c1, c2) {
-				foundEqual = true
-				break
-			}
-		}
-
-		if !foundEqual {
-			return false
-		}
-	}
-
-	return true
+	return DiffNodes(n1, n2) == ""
 }
 
+// printNode renders n as a canonical, indented multi-line tree with children sorted by Key, so two
+// equivalent trees built in a different order print identically and a diff between two test
+// failures is actually readable.
 func printNode(n *etcd.Node) string {
+	return printNodeIndented(n, 0)
+}
+
+func printNodeIndented(n *etcd.Node, depth int) string {
 	if n == nil {
 		return ""
 	}
 
-	dir := "false"
-	if n.Dir {
-		dir = "true"
-	}
+	indent := strings.Repeat("  ", depth)
 
-	ttl := strconv.FormatInt(n.TTL, 10)
+	output := fmt.Sprintf("%s{ Key: %q, Value: %q, Dir: %v, TTL: %d",
+		indent, n.Key, n.Value, n.Dir, n.TTL)
 
-	output := "{ " +
-		"Key: '" + n.Key + "', " +
-		"Value: '" + n.Value + "', " +
-		"Dir: " + dir + ", " +
-		"TTL: " + ttl + ", " +
-		"Nodes: ["
+	if len(n.Nodes) == 0 {
+		return output + " }"
+	}
 
-	for _, c := range n.Nodes {
-		output += printNode(c)
+	output += ", Nodes: [\n"
+	for _, c := range sortedNodes(n.Nodes) {
+		output += printNodeIndented(c, depth+1) + "\n"
 	}
+	output += indent + "] }"
 
-	output += "] }"
 	return output
 }
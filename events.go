@@ -0,0 +1,273 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Action identifies what kind of change an Event describes
+type Action string
+
+// Possible values for Event.Action
+const (
+	ActionSet    Action = "set"
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+	ActionExpire Action = "expire"
+
+	// ActionResync is emitted instead of a regular change whenever the watched revision was
+	// compacted out of etcd's history: Events reloads the whole configuration and resumes watching
+	// from the current revision, since it can no longer tell what changed in between. Path, IsDir,
+	// PrevValue, Value, ModifiedIndex and Field are left at their zero value
+	ActionResync Action = "resync"
+
+	// ActionError is emitted, as the last Event before the channel closes, whenever the underlying
+	// watch ends with an error Events cannot recover from on its own (anything other than a
+	// compacted revision, which ActionResync already handles). Err carries that error; every other
+	// field is left at its zero value
+	ActionError Action = "error"
+)
+
+// Event describes a single change observed by Client.Events, already resolved to the Go struct
+// field it affects (when the path matches one tracked by a previous Load/Save/Watch)
+type Event struct {
+	Path          string
+	Action        Action
+	IsDir         bool
+	PrevValue     string
+	Value         string
+	ModifiedIndex uint64
+	Field         reflect.Value
+
+	// Err is only set on an ActionError Event, carrying the error that ended the watch
+	Err error
+}
+
+// Events starts a single recursive watcher rooted at the struct's prefix and returns a channel
+// delivering one Event per change observed in etcd, resuming after the last seen ModifiedIndex
+// across reconnects. Unlike Watch, a single long-lived watcher is used regardless of how many
+// fields are being tracked, changes are applied to the bound configuration struct under a
+// read/write lock (see Snapshot), and errors are surfaced on the channel instead of being silently
+// dropped. If the watched revision was compacted out of etcd's history, Events reloads the whole
+// configuration, resumes watching from the current revision and emits an ActionResync Event
+// instead of giving up. Any other error ends the watch: it is delivered as one last ActionError
+// Event (Err holds it) before the channel closes, instead of closing silently with nothing to
+// tell the caller why
+func (c *Client) Events(ctx context.Context) (<-chan Event, error) {
+	out := make(chan Event)
+
+	go func() {
+		defer close(out)
+
+		afterIndex := uint64(0)
+
+		for {
+			receiver := make(chan *Node)
+			stop := make(chan bool)
+			errc := make(chan error, 1)
+
+			go func() {
+				_, err := c.backend.Watch(ctx, c.root(), afterIndex, true, receiver, stop)
+				errc <- err
+			}()
+
+			select {
+			case node := <-receiver:
+				close(stop)
+
+				if node == nil {
+					return
+				}
+
+				afterIndex = node.ModifiedIndex + 1
+
+				select {
+				case out <- c.applyEvent(node):
+				case <-ctx.Done():
+					return
+				}
+
+			case err := <-errc:
+				if !compactedError(err) {
+					select {
+					case out <- Event{Action: ActionError, Err: err}:
+					case <-ctx.Done():
+					}
+					return
+				}
+
+				if err := c.Load(ctx); err != nil {
+					select {
+					case out <- Event{Action: ActionError, Err: err}:
+					case <-ctx.Done():
+					}
+					return
+				}
+				afterIndex = 0
+
+				select {
+				case out <- Event{Action: ActionResync}:
+				case <-ctx.Done():
+					return
+				}
+
+			case <-ctx.Done():
+				close(stop)
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// applyEvent locks the configuration, applies node's change to the Go field it maps to (a leaf
+// field directly, or a map entry/slice element of an already known parent field) and returns the
+// resulting Event
+func (c *Client) applyEvent(node *Node) Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	event := Event{
+		Path:          node.Key,
+		Action:        Action(node.Action),
+		IsDir:         node.Dir,
+		PrevValue:     node.PrevValue,
+		Value:         node.Value,
+		ModifiedIndex: node.ModifiedIndex,
+	}
+
+	if fieldInfo, ok := c.info[node.Key]; ok {
+		event.Field = fieldInfo.field
+		setScalar(fieldInfo.field, node.Value)
+		c.info[node.Key] = info{field: fieldInfo.field, version: node.ModifiedIndex}
+		if c.cache != nil {
+			c.cache.set(node.Key, node.ModifiedIndex, fieldInfo.field, node.Value, fieldInfo.codec)
+		}
+		return event
+	}
+
+	separator := strings.LastIndex(node.Key, "/")
+	if separator <= 0 {
+		return event
+	}
+
+	parentPath := node.Key[:separator]
+	key := node.Key[separator+1:]
+
+	parentInfo, ok := c.info[parentPath]
+	if !ok {
+		return event
+	}
+
+	event.Field = parentInfo.field
+	deleted := event.Action == ActionDelete || event.Action == ActionExpire
+
+	switch parentInfo.field.Kind() {
+	case reflect.Map:
+		if deleted {
+			parentInfo.field.SetMapIndex(reflect.ValueOf(key), reflect.Value{})
+		} else {
+			parentInfo.field.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(node.Value))
+		}
+
+	case reflect.Slice:
+		if deleted {
+			if index, err := strconv.Atoi(key); err == nil && index >= 0 && index < parentInfo.field.Len() {
+				parentInfo.field.Set(reflect.AppendSlice(
+					parentInfo.field.Slice(0, index),
+					parentInfo.field.Slice(index+1, parentInfo.field.Len()),
+				))
+			}
+		}
+	}
+
+	// The parent's cached subtree no longer reflects what was just applied to one of its entries; drop
+	// it so the next Load or Watch rebuilds it instead of restoring the stale cached copy.
+	if c.cache != nil {
+		c.cache.invalidate(parentPath)
+	}
+
+	return event
+}
+
+// setScalar assigns value to field, ignoring kinds (and malformed values) it doesn't know how to
+// parse; it is only used for leaf fields already validated by a previous Load/Save/Watch
+func setScalar(field reflect.Value, value string) {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+
+	case reflect.Int, reflect.Int64:
+		if parsed, err := strconv.ParseInt(value, 10, 64); err == nil {
+			field.SetInt(parsed)
+		}
+
+	case reflect.Bool:
+		field.SetBool(value == "true")
+	}
+}
+
+// deepCopy recursively clones v so the result shares no backing array, map or pointer with it.
+// Kinds it doesn't recognize (anything beyond what Save/Load already support) are returned as-is
+func deepCopy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.New(v.Elem().Type())
+		cp.Elem().Set(deepCopy(v.Elem()))
+		return cp
+
+	case reflect.Struct:
+		cp := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			if cp.Field(i).CanSet() {
+				cp.Field(i).Set(deepCopy(v.Field(i)))
+			}
+		}
+		return cp
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, key := range v.MapKeys() {
+			cp.SetMapIndex(key, deepCopy(v.MapIndex(key)))
+		}
+		return cp
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			cp.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return cp
+
+	default:
+		return v
+	}
+}
+
+// Snapshot returns a deep copy of the configuration struct currently bound to the client, safe to
+// read even while a concurrent Events goroutine is applying updates
+func (c *Client) Snapshot() interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	cp := reflect.New(c.config.Elem().Type())
+	cp.Elem().Set(deepCopy(c.config.Elem()))
+	return cp.Interface()
+}
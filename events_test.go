@@ -0,0 +1,56 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+)
+
+func TestEventsError(t *testing.T) {
+	config := struct {
+		Field string `etcd:"/field"`
+	}{}
+
+	mock := NewClientMock()
+	mock.root = &etcd.Node{Dir: true}
+	mock.watchErrors["/"] = &etcd.EtcdError{ErrorCode: int(etcdErrorCodeRaftInternal)}
+
+	c := Client{
+		backend: newV2Backend(mock),
+		config:  reflect.ValueOf(&config),
+		info:    make(map[string]info),
+		codecs:  defaultCodecs(),
+	}
+	c.preload(c.config, "", "")
+
+	events, err := c.Events(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error starting Events: %s", err)
+	}
+
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("events channel closed without delivering the error")
+		}
+		if event.Action != ActionError {
+			t.Fatalf("expected an ActionError event, found %q", event.Action)
+		}
+		if event.Err == nil {
+			t.Fatal("expected Event.Err to carry the watch error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the error event")
+	}
+
+	if _, ok := <-events; ok {
+		t.Fatal("expected the events channel to close right after the error event")
+	}
+}
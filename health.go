@@ -0,0 +1,103 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// ErrHealthCheckNotSupported is returned by Client.HealthCheck when the backend has no way to
+// report per-machine cluster membership. Only BackendV2 satisfies healthChecker today.
+var ErrHealthCheckNotSupported = errors.New("etcetera: backend does not support health checking")
+
+// MemberHealth is a single etcd machine's own report of the cluster it belongs to, as collected by
+// Client.HealthCheck.
+type MemberHealth struct {
+	Endpoint  string
+	Reachable bool
+	ClusterID string
+	Members   []string
+	Err       error
+}
+
+// ClusterHealth is the result of Client.HealthCheck: every queried machine's own view, plus the
+// three split-brain signals aenix-io/etcd-operator watches for - a machine that didn't respond at
+// all, machines disagreeing on cluster ID, or machines disagreeing on who else is in the cluster.
+type ClusterHealth struct {
+	Members []MemberHealth
+
+	// Unreachable lists the endpoints of members that could not be queried at all.
+	Unreachable []string
+
+	// ClusterIDMismatch is true when reachable members don't all report the same ClusterID, meaning
+	// some of them believe they belong to a different cluster entirely.
+	ClusterIDMismatch bool
+
+	// MemberListMismatch is true when reachable members don't all report the same set of members,
+	// meaning the cluster has split and each side only sees part of it.
+	MemberListMismatch bool
+}
+
+// Healthy reports whether none of the three split-brain signals fired: every member answered, and
+// every one of them agreed on both the cluster ID and the member list.
+func (h ClusterHealth) Healthy() bool {
+	return len(h.Unreachable) == 0 && !h.ClusterIDMismatch && !h.MemberListMismatch
+}
+
+// healthChecker is implemented by backends that can report each configured machine's own view of
+// cluster membership, used by Client.HealthCheck to detect a partitioned cluster. Only BackendV2
+// satisfies it; Client.HealthCheck reports ErrHealthCheckNotSupported on backends that don't.
+type healthChecker interface {
+	Health(ctx context.Context) (ClusterHealth, error)
+}
+
+// HealthCheck asks every machine the backend knows about for its own view of the cluster and
+// reports whether they agree. Apps calling Load or Save can use it to fail fast instead of reading
+// from a partitioned follower. It requires a backend that supports per-machine queries (BackendV2
+// today); other backends return ErrHealthCheckNotSupported.
+func (c *Client) HealthCheck(ctx context.Context) (ClusterHealth, error) {
+	checker, ok := c.backend.(healthChecker)
+	if !ok {
+		return ClusterHealth{}, ErrHealthCheckNotSupported
+	}
+
+	return checker.Health(ctx)
+}
+
+// clusterHealthFromMembers compares what each member reported and fills in the three split-brain
+// signals, leaving the ones backed by zero reachable members false rather than flagging a mismatch
+// no one actually disagreed on.
+func clusterHealthFromMembers(members []MemberHealth) ClusterHealth {
+	health := ClusterHealth{Members: members}
+
+	clusterIDs := make(map[string]bool)
+	memberLists := make(map[string]bool)
+
+	for _, member := range members {
+		if !member.Reachable {
+			health.Unreachable = append(health.Unreachable, member.Endpoint)
+			continue
+		}
+
+		clusterIDs[member.ClusterID] = true
+		memberLists[sortedJoin(member.Members)] = true
+	}
+
+	health.ClusterIDMismatch = len(clusterIDs) > 1
+	health.MemberListMismatch = len(memberLists) > 1
+
+	return health
+}
+
+// sortedJoin gives two member lists holding the same machines (in any order) the same key, so
+// comparing them is a map-key comparison instead of an order-sensitive one.
+func sortedJoin(values []string) string {
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
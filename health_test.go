@@ -0,0 +1,161 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestClusterHealthFromMembers(t *testing.T) {
+	data := []struct {
+		description string
+		members     []MemberHealth
+		expected    ClusterHealth
+	}{
+		{
+			description: "it should report a healthy cluster when every member agrees",
+			members: []MemberHealth{
+				{Endpoint: "http://127.0.0.1:4001", Reachable: true, ClusterID: "abc", Members: []string{"1", "2", "3"}},
+				{Endpoint: "http://127.0.0.1:4002", Reachable: true, ClusterID: "abc", Members: []string{"3", "1", "2"}},
+			},
+			expected: ClusterHealth{
+				Members: []MemberHealth{
+					{Endpoint: "http://127.0.0.1:4001", Reachable: true, ClusterID: "abc", Members: []string{"1", "2", "3"}},
+					{Endpoint: "http://127.0.0.1:4002", Reachable: true, ClusterID: "abc", Members: []string{"3", "1", "2"}},
+				},
+			},
+		},
+		{
+			description: "it should flag an unreachable member without treating it as a disagreement",
+			members: []MemberHealth{
+				{Endpoint: "http://127.0.0.1:4001", Reachable: true, ClusterID: "abc", Members: []string{"1", "2"}},
+				{Endpoint: "http://127.0.0.1:4002", Reachable: false, Err: errors.New("connection refused")},
+			},
+			expected: ClusterHealth{
+				Members: []MemberHealth{
+					{Endpoint: "http://127.0.0.1:4001", Reachable: true, ClusterID: "abc", Members: []string{"1", "2"}},
+					{Endpoint: "http://127.0.0.1:4002", Reachable: false, Err: errors.New("connection refused")},
+				},
+				Unreachable: []string{"http://127.0.0.1:4002"},
+			},
+		},
+		{
+			description: "it should flag disagreement on cluster ID",
+			members: []MemberHealth{
+				{Endpoint: "http://127.0.0.1:4001", Reachable: true, ClusterID: "abc", Members: []string{"1", "2"}},
+				{Endpoint: "http://127.0.0.1:4002", Reachable: true, ClusterID: "xyz", Members: []string{"1", "2"}},
+			},
+			expected: ClusterHealth{
+				Members: []MemberHealth{
+					{Endpoint: "http://127.0.0.1:4001", Reachable: true, ClusterID: "abc", Members: []string{"1", "2"}},
+					{Endpoint: "http://127.0.0.1:4002", Reachable: true, ClusterID: "xyz", Members: []string{"1", "2"}},
+				},
+				ClusterIDMismatch: true,
+			},
+		},
+		{
+			description: "it should flag disagreement on member list",
+			members: []MemberHealth{
+				{Endpoint: "http://127.0.0.1:4001", Reachable: true, ClusterID: "abc", Members: []string{"1", "2"}},
+				{Endpoint: "http://127.0.0.1:4002", Reachable: true, ClusterID: "abc", Members: []string{"1", "2", "3"}},
+			},
+			expected: ClusterHealth{
+				Members: []MemberHealth{
+					{Endpoint: "http://127.0.0.1:4001", Reachable: true, ClusterID: "abc", Members: []string{"1", "2"}},
+					{Endpoint: "http://127.0.0.1:4002", Reachable: true, ClusterID: "abc", Members: []string{"1", "2", "3"}},
+				},
+				MemberListMismatch: true,
+			},
+		},
+	}
+
+	for i, item := range data {
+		health := clusterHealthFromMembers(item.members)
+
+		if health.ClusterIDMismatch != item.expected.ClusterIDMismatch ||
+			health.MemberListMismatch != item.expected.MemberListMismatch ||
+			len(health.Unreachable) != len(item.expected.Unreachable) {
+
+			t.Errorf("Item %d, “%s”: health mismatch. Expecting “%+v”; found “%+v”",
+				i, item.description, item.expected, health)
+			continue
+		}
+
+		for j, endpoint := range item.expected.Unreachable {
+			if health.Unreachable[j] != endpoint {
+				t.Errorf("Item %d, “%s”: unreachable mismatch. Expecting “%v”; found “%v”",
+					i, item.description, item.expected.Unreachable, health.Unreachable)
+				break
+			}
+		}
+
+		if item.expected.Healthy() != health.Healthy() {
+			t.Errorf("Item %d, “%s”: Healthy mismatch. Expecting %v; found %v",
+				i, item.description, item.expected.Healthy(), health.Healthy())
+		}
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	data := []struct {
+		description string
+		members     []MemberHealth
+		expected    ClusterHealth
+	}{
+		{
+			description: "it should report a healthy cluster",
+			members: []MemberHealth{
+				{Endpoint: "http://127.0.0.1:4001", Reachable: true, ClusterID: "abc", Members: []string{"1"}},
+			},
+			expected: ClusterHealth{
+				Members: []MemberHealth{
+					{Endpoint: "http://127.0.0.1:4001", Reachable: true, ClusterID: "abc", Members: []string{"1"}},
+				},
+			},
+		},
+		{
+			description: "it should report members disagreeing on cluster ID",
+			members: []MemberHealth{
+				{Endpoint: "http://127.0.0.1:4001", Reachable: true, ClusterID: "abc", Members: []string{"1", "2"}},
+				{Endpoint: "http://127.0.0.1:4002", Reachable: true, ClusterID: "def", Members: []string{"1", "2"}},
+			},
+			expected: ClusterHealth{
+				Members: []MemberHealth{
+					{Endpoint: "http://127.0.0.1:4001", Reachable: true, ClusterID: "abc", Members: []string{"1", "2"}},
+					{Endpoint: "http://127.0.0.1:4002", Reachable: true, ClusterID: "def", Members: []string{"1", "2"}},
+				},
+				ClusterIDMismatch: true,
+			},
+		},
+	}
+
+	for i, item := range data {
+		mock := NewClientMock()
+		mock.members = item.members
+
+		c := Client{backend: newV2Backend(mock)}
+
+		health, err := c.HealthCheck(context.Background())
+		if err != nil {
+			t.Errorf("Item %d, “%s”: unexpected error. %s", i, item.description, err.Error())
+			continue
+		}
+
+		if health.Healthy() != item.expected.Healthy() {
+			t.Errorf("Item %d, “%s”: Healthy mismatch. Expecting %v; found %v",
+				i, item.description, item.expected.Healthy(), health.Healthy())
+		}
+	}
+}
+
+func TestHealthCheckNotSupported(t *testing.T) {
+	c := Client{backend: &keysAPIBackend{}}
+
+	if _, err := c.HealthCheck(context.Background()); err != ErrHealthCheckNotSupported {
+		t.Errorf("expecting ErrHealthCheckNotSupported, found “%v”", err)
+	}
+}
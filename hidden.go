@@ -0,0 +1,61 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import "strings"
+
+// HiddenPolicy controls how Load and Watch treat a node whose last path component begins with
+// "_", the same convention etcd's own store uses to hide bookkeeping keys from a plain directory
+// listing.
+type HiddenPolicy int
+
+const (
+	// HideHidden skips every hidden node, so bookkeeping keys stored alongside user-visible
+	// configuration never end up in a loaded struct by accident. This is the default.
+	HideHidden HiddenPolicy = iota
+
+	// ShowHidden processes hidden nodes the same as visible ones.
+	ShowHidden
+
+	// OnlyHidden processes only hidden nodes, skipping every visible one. Meant for a Client set up
+	// to read the bookkeeping keys back out rather than the user-visible configuration.
+	OnlyHidden
+)
+
+// WithHiddenPolicy sets how Load and Watch treat hidden ("_"-prefixed) nodes. It returns c so it
+// can be chained right after NewClient or NewClientWithConfig. The default, HideHidden, is what a
+// Client has without calling this.
+func (c *Client) WithHiddenPolicy(policy HiddenPolicy) *Client {
+	c.hiddenPolicy = policy
+	return c
+}
+
+// isHidden reports whether path is a hidden node: either its own last path component begins with
+// "_", or the field that maps to it carries the "hidden" tag option, for fields kept outside the
+// "_" naming convention.
+func isHidden(path string, tagged bool) bool {
+	if tagged {
+		return true
+	}
+
+	name := path
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		name = path[i+1:]
+	}
+
+	return strings.HasPrefix(name, "_")
+}
+
+// allows reports whether a node with the given hidden-ness should be processed under policy p.
+func (p HiddenPolicy) allows(hidden bool) bool {
+	switch p {
+	case ShowHidden:
+		return true
+	case OnlyHidden:
+		return hidden
+	default:
+		return !hidden
+	}
+}
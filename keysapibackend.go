@@ -0,0 +1,189 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	etcdclient "github.com/coreos/etcd/client"
+)
+
+// keysAPIBackend adapts the context-aware github.com/coreos/etcd/client Keys API to the kv
+// interface. Unlike v2Backend, every call honors ctx for cancellation and deadlines, and reads are
+// issued with quorum consistency so a client never observes a stale value from a single follower.
+type keysAPIBackend struct {
+	api etcdclient.KeysAPI
+}
+
+func newKeysAPIBackend(cfg Config) (*keysAPIBackend, error) {
+	etcdCfg := etcdclient.Config{
+		Endpoints:               cfg.Endpoints,
+		Transport:               etcdclient.DefaultTransport,
+		HeaderTimeoutPerRequest: cfg.DialTimeout,
+		Username:                cfg.Username,
+		Password:                cfg.Password,
+	}
+
+	if cfg.TLS != nil {
+		etcdCfg.Transport = &http.Transport{TLSClientConfig: cfg.TLS}
+	}
+
+	c, err := etcdclient.New(etcdCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &keysAPIBackend{api: etcdclient.NewKeysAPI(c)}, nil
+}
+
+func (b *keysAPIBackend) Get(ctx context.Context, path string, sort, recursive bool) (*Node, error) {
+	resp, err := b.api.Get(ctx, path, &etcdclient.GetOptions{
+		Recursive: recursive,
+		Sort:      sort,
+		Quorum:    true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nodeFromKeysAPI(resp.Node), nil
+}
+
+func (b *keysAPIBackend) Set(ctx context.Context, path, value string, ttl uint64) (*Node, error) {
+	resp, err := b.api.Set(ctx, path, value, &etcdclient.SetOptions{TTL: time.Duration(ttl) * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return nodeFromKeysAPI(resp.Node), nil
+}
+
+func (b *keysAPIBackend) Create(ctx context.Context, path, value string, ttl uint64) (*Node, error) {
+	resp, err := b.api.Set(ctx, path, value, &etcdclient.SetOptions{
+		TTL:       time.Duration(ttl) * time.Second,
+		PrevExist: etcdclient.PrevNoExist,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nodeFromKeysAPI(resp.Node), nil
+}
+
+func (b *keysAPIBackend) CreateDir(ctx context.Context, path string, ttl uint64) (*Node, error) {
+	resp, err := b.api.Set(ctx, path, "", &etcdclient.SetOptions{
+		Dir:       true,
+		TTL:       time.Duration(ttl) * time.Second,
+		PrevExist: etcdclient.PrevNoExist,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nodeFromKeysAPI(resp.Node), nil
+}
+
+func (b *keysAPIBackend) CreateInOrder(ctx context.Context, path, value string, ttl uint64) (*Node, error) {
+	resp, err := b.api.CreateInOrder(ctx, path, value, &etcdclient.CreateInOrderOptions{
+		TTL: time.Duration(ttl) * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nodeFromKeysAPI(resp.Node), nil
+}
+
+func (b *keysAPIBackend) Delete(ctx context.Context, path string, recursive bool) (*Node, error) {
+	resp, err := b.api.Delete(ctx, path, &etcdclient.DeleteOptions{Recursive: recursive})
+	if err != nil {
+		return nil, err
+	}
+	return nodeFromKeysAPI(resp.Node), nil
+}
+
+func (b *keysAPIBackend) CompareAndSwap(ctx context.Context, path, value string, ttl uint64, prevValue string, prevIndex uint64) (*Node, error) {
+	resp, err := b.api.Set(ctx, path, value, &etcdclient.SetOptions{
+		TTL:       time.Duration(ttl) * time.Second,
+		PrevValue: prevValue,
+		PrevIndex: prevIndex,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nodeFromKeysAPI(resp.Node), nil
+}
+
+func (b *keysAPIBackend) CompareAndDelete(ctx context.Context, path, prevValue string, prevIndex uint64) (*Node, error) {
+	resp, err := b.api.Delete(ctx, path, &etcdclient.DeleteOptions{
+		PrevValue: prevValue,
+		PrevIndex: prevIndex,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nodeFromKeysAPI(resp.Node), nil
+}
+
+func (b *keysAPIBackend) Watch(ctx context.Context, path string, waitIndex uint64, recursive bool, receiver chan *Node, stop chan bool) (*Node, error) {
+	watcher := b.api.Watcher(path, &etcdclient.WatcherOptions{
+		AfterIndex: waitIndex,
+		Recursive:  recursive,
+	})
+
+	for {
+		select {
+		case <-stop:
+			return nil, nil
+		default:
+		}
+
+		resp, err := watcher.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		node := nodeFromKeysAPIResponse(resp)
+		select {
+		case receiver <- node:
+		case <-stop:
+			return node, nil
+		}
+	}
+}
+
+// nodeFromKeysAPIResponse converts a coreos/etcd/client watch response into a Node, also carrying
+// the action that triggered it and the value the key held beforehand (when available).
+func nodeFromKeysAPIResponse(resp *etcdclient.Response) *Node {
+	node := nodeFromKeysAPI(resp.Node)
+	if node == nil {
+		return nil
+	}
+
+	node.Action = resp.Action
+	if resp.PrevNode != nil {
+		node.PrevValue = resp.PrevNode.Value
+	}
+
+	return node
+}
+
+// nodeFromKeysAPI converts a coreos/etcd/client node (and its children) into the backend-agnostic
+// Node type.
+func nodeFromKeysAPI(n *etcdclient.Node) *Node {
+	if n == nil {
+		return nil
+	}
+
+	node := &Node{
+		Key:           n.Key,
+		Value:         n.Value,
+		Dir:           n.Dir,
+		ModifiedIndex: n.ModifiedIndex,
+	}
+
+	for _, child := range n.Nodes {
+		node.Nodes = append(node.Nodes, nodeFromKeysAPI(child))
+	}
+
+	return node
+}
@@ -0,0 +1,364 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Format identifies how FileSource decodes a configuration file.
+type Format int
+
+// Possible values for Format
+const (
+	FormatJSON Format = iota
+	FormatYAML
+	FormatTOML
+)
+
+// Source supplies values for LoadLayered to apply to the configuration struct before etcd's own
+// values overlay on top, keyed by the same etcd tag paths Save and Load use to locate leaves.
+// FileSource, EnvSource, FlagSource and DefaultsSource are the built-in implementations.
+type Source interface {
+	// values resolves every leaf this source can supply. paths lists every scalar field's tag
+	// path in the configuration being loaded; EnvSource and FlagSource need it to know which
+	// environment variables or flags to look for, while FileSource and DefaultsSource ignore it
+	values(paths []string) (map[string]string, error)
+}
+
+// fileSource is the Source returned by FileSource.
+type fileSource struct {
+	path   string
+	format Format
+}
+
+// FileSource reads path, decoded according to format (JSON, YAML or TOML), and resolves leaves by
+// walking the decoded document as if its keys were a JSON pointer matching the tag path: the value
+// for tag "/db/host" comes from the file's top-level "db" object, "host" key.
+func FileSource(path string, format Format) Source {
+	return fileSource{path: path, format: format}
+}
+
+func (s fileSource) values(paths []string) (map[string]string, error) {
+	raw, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var root map[string]interface{}
+
+	switch s.format {
+	case FormatYAML:
+		err = yaml.Unmarshal(raw, &root)
+	case FormatTOML:
+		err = toml.Unmarshal(raw, &root)
+	default:
+		err = json.Unmarshal(raw, &root)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	flattenPointer("", root, values)
+	return values, nil
+}
+
+// flattenPointer walks a document decoded from FileSource into a flat map keyed by JSON pointer
+// (e.g. "/db/host"), stringifying every leaf value it finds.
+func flattenPointer(prefix string, v interface{}, out map[string]string) {
+	if m, ok := v.(map[string]interface{}); ok {
+		for key, sub := range m {
+			flattenPointer(prefix+"/"+key, sub, out)
+		}
+		return
+	}
+
+	out[prefix] = fmt.Sprintf("%v", v)
+}
+
+// envSource is the Source returned by EnvSource.
+type envSource struct {
+	prefix string
+}
+
+// EnvSource resolves leaves from environment variables, deriving each one's name from its tag
+// path: slashes become underscores and the result is upper-cased, so "/db/host" looks up DB_HOST
+// (or PREFIX_DB_HOST when prefix is non-empty).
+func EnvSource(prefix string) Source {
+	return envSource{prefix: prefix}
+}
+
+func (s envSource) values(paths []string) (map[string]string, error) {
+	values := make(map[string]string)
+
+	for _, path := range paths {
+		if value, ok := os.LookupEnv(envName(s.prefix, path)); ok {
+			values[path] = value
+		}
+	}
+
+	return values, nil
+}
+
+func envName(prefix, path string) string {
+	name := strings.ToUpper(strings.Trim(strings.ReplaceAll(path, "/", "_"), "_"))
+	if len(prefix) == 0 {
+		return name
+	}
+
+	return strings.ToUpper(prefix) + "_" + name
+}
+
+// flagSource is the Source returned by FlagSource.
+type flagSource struct {
+	fs *flag.FlagSet
+}
+
+// FlagSource resolves leaves from fs, a FlagSet the caller has already parsed, considering only
+// flags actually set on the command line (see flag.FlagSet.Visit) so an untouched flag's zero
+// value never overrides a lower layer. Each leaf's flag name is derived from its tag path the same
+// way EnvSource derives an environment variable name, except slashes become hyphens and the result
+// stays lower-case: the tag path "/db/host" looks for a flag named "db-host".
+func FlagSource(fs *flag.FlagSet) Source {
+	return flagSource{fs: fs}
+}
+
+func (s flagSource) values(paths []string) (map[string]string, error) {
+	set := make(map[string]bool)
+	s.fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	values := make(map[string]string)
+	for _, path := range paths {
+		name := flagName(path)
+		if !set[name] {
+			continue
+		}
+
+		if f := s.fs.Lookup(name); f != nil {
+			values[path] = f.Value.String()
+		}
+	}
+
+	return values, nil
+}
+
+func flagName(path string) string {
+	return strings.ToLower(strings.Trim(strings.ReplaceAll(path, "/", "-"), "-"))
+}
+
+// defaultsSource is the Source returned by DefaultsSource.
+type defaultsSource struct {
+	ptr interface{}
+}
+
+// DefaultsSource resolves leaves straight from ptr, a pointer to a structure tagged the same way
+// as the configuration being loaded (typically an instance of that very type) with its fields set
+// to the desired defaults.
+func DefaultsSource(ptr interface{}) Source {
+	return defaultsSource{ptr: ptr}
+}
+
+func (s defaultsSource) values(paths []string) (map[string]string, error) {
+	configValue := reflect.ValueOf(s.ptr)
+	if configValue.Kind() != reflect.Ptr || configValue.Elem().Kind() != reflect.Struct {
+		return nil, ErrInvalidConfig
+	}
+
+	values := make(map[string]string)
+	collectScalarValues(configValue, "", values)
+	return values, nil
+}
+
+// collectScalarValues walks config (a struct, addressed the same way preload walks the bound
+// configuration) collecting every scalar leaf's tag path and etcd representation into values.
+func collectScalarValues(config reflect.Value, pathPrefix string, values map[string]string) {
+	config = config.Elem()
+	if config.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < config.NumField(); i++ {
+		field := config.Field(i)
+		fieldType := config.Type().Field(i)
+
+		path, _ := parseTag(fieldType.Tag.Get("etcd"))
+		if len(path) == 0 {
+			continue
+		}
+		path = pathPrefix + path
+
+		target := field
+		if target.Kind() == reflect.Ptr {
+			if target.IsNil() {
+				continue
+			}
+			target = target.Elem()
+		}
+
+		if target.Kind() == reflect.Struct {
+			collectScalarValues(target.Addr(), path, values)
+			continue
+		}
+
+		if value, ok := scalarString(target); ok {
+			values[path] = value
+		}
+	}
+}
+
+// leafPaths walks config the same way collectScalarValues does, but only to list the tag path of
+// every scalar leaf field, regardless of its current value; EnvSource needs this list upfront
+// since it has no document of its own to walk.
+func (c *Client) leafPaths(config reflect.Value, pathPrefix string) []string {
+	config = config.Elem()
+	if config.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var paths []string
+
+	for i := 0; i < config.NumField(); i++ {
+		field := config.Field(i)
+		fieldType := config.Type().Field(i)
+
+		path, _ := parseTag(fieldType.Tag.Get("etcd"))
+		if len(path) == 0 {
+			continue
+		}
+		path = pathPrefix + path
+
+		target := field
+		if target.Kind() == reflect.Ptr {
+			if target.IsNil() {
+				continue
+			}
+			target = target.Elem()
+		}
+
+		if target.Kind() == reflect.Struct {
+			paths = append(paths, c.leafPaths(target.Addr(), path)...)
+			continue
+		}
+
+		if _, ok := scalarString(target); ok {
+			paths = append(paths, path)
+		}
+	}
+
+	return paths
+}
+
+// applyLeafValues walks config like leafPaths, setting every scalar leaf field found in values to
+// its corresponding parsed value.
+func applyLeafValues(config reflect.Value, pathPrefix string, values map[string]string) {
+	config = config.Elem()
+	if config.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < config.NumField(); i++ {
+		field := config.Field(i)
+		fieldType := config.Type().Field(i)
+
+		path, _ := parseTag(fieldType.Tag.Get("etcd"))
+		if len(path) == 0 {
+			continue
+		}
+		path = pathPrefix + path
+
+		target := field
+		if target.Kind() == reflect.Ptr {
+			if target.IsNil() {
+				continue
+			}
+			target = target.Elem()
+		}
+
+		if target.Kind() == reflect.Struct {
+			applyLeafValues(target.Addr(), path, values)
+			continue
+		}
+
+		if value, ok := values[path]; ok {
+			parseScalarString(target, value)
+		}
+	}
+}
+
+// parseScalarString is scalarString's write-side counterpart: it assigns value to field, ignoring
+// kinds it doesn't know how to parse and malformed values alike, since a layer that can't supply a
+// field should simply leave it to the next one (or to etcd) rather than fail the whole load.
+func parseScalarString(field reflect.Value, value string) {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+
+	case reflect.Int, reflect.Int64:
+		if parsed, err := strconv.ParseInt(value, 10, 64); err == nil {
+			field.SetInt(parsed)
+		}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if parsed, err := strconv.ParseUint(value, 10, 64); err == nil {
+			field.SetUint(parsed)
+		}
+
+	case reflect.Float32, reflect.Float64:
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+			field.SetFloat(parsed)
+		}
+
+	case reflect.Bool:
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			field.SetBool(parsed)
+		}
+	}
+}
+
+// LoadLayered applies sources in order onto the configuration struct (each overwriting whatever
+// the previous one set), then Load's etcd values overlay on top of all of them. Unlike a plain
+// Load, a scalar field with no matching key in etcd keeps the value a Source gave it instead of
+// failing the whole load, so a FileSource or DefaultsSource can act as a fallback for
+// configuration that hasn't been pushed to etcd yet.
+func (c *Client) LoadLayered(ctx context.Context, sources ...Source) error {
+	c.mu.Lock()
+	paths := c.leafPaths(c.config, "")
+	c.mu.Unlock()
+
+	for _, source := range sources {
+		values, err := source.values(paths)
+		if err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		applyLeafValues(c.config, "", values)
+		c.mu.Unlock()
+	}
+
+	filter, err := newACLFilter(ctx, c.auth)
+	if err != nil {
+		return err
+	}
+
+	if err := c.load(ctx, c.config, c.namespace, true, filter); err != nil {
+		return err
+	}
+
+	return filter.err()
+}
@@ -0,0 +1,83 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/go-etcd/etcd"
+)
+
+func TestLoadLayered(t *testing.T) {
+	type layeredConfig struct {
+		Field string `etcd:"/field"`
+		Other string `etcd:"/other"`
+	}
+
+	config := layeredConfig{}
+	defaults := layeredConfig{Field: "default-field", Other: "default-other"}
+
+	mock := NewClientMock()
+	mock.root = &etcd.Node{
+		Dir: true,
+		Nodes: etcd.Nodes{
+			{Key: "/field", Value: "etcd-field"},
+		},
+	}
+
+	c := Client{
+		backend: newV2Backend(mock),
+		config:  reflect.ValueOf(&config),
+		info:    make(map[string]info),
+		codecs:  defaultCodecs(),
+	}
+	c.preload(c.config, "", "")
+
+	if err := c.LoadLayered(context.Background(), DefaultsSource(&defaults)); err != nil {
+		t.Fatalf("unexpected error loading the layered configuration: %s", err)
+	}
+
+	// /field exists in etcd, so it overrides the default; /other doesn't, so the default stands
+	if config.Field != "etcd-field" {
+		t.Errorf("expected Field to be %q, found %q", "etcd-field", config.Field)
+	}
+	if config.Other != "default-other" {
+		t.Errorf("expected Other to keep the default %q, found %q", "default-other", config.Other)
+	}
+}
+
+func TestLoadLayeredSourceOrder(t *testing.T) {
+	type layeredConfig struct {
+		Field string `etcd:"/field"`
+	}
+
+	config := layeredConfig{}
+
+	mock := NewClientMock()
+	mock.root = &etcd.Node{Dir: true}
+
+	c := Client{
+		backend: newV2Backend(mock),
+		config:  reflect.ValueOf(&config),
+		info:    make(map[string]info),
+		codecs:  defaultCodecs(),
+	}
+	c.preload(c.config, "", "")
+
+	// Later sources overwrite earlier ones, the same way a later entry wins in a stack of defaults
+	err := c.LoadLayered(context.Background(),
+		DefaultsSource(&layeredConfig{Field: "first"}),
+		DefaultsSource(&layeredConfig{Field: "second"}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error loading the layered configuration: %s", err)
+	}
+
+	if config.Field != "second" {
+		t.Errorf("expected the later source to win with %q, found %q", "second", config.Field)
+	}
+}
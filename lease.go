@@ -0,0 +1,50 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrLeaseNotSupported is returned by KeepAlive when the backend has no notion of a shared lease.
+// Only BackendV3 satisfies leaser today
+var ErrLeaseNotSupported = errors.New("etcetera: backend does not support leases")
+
+// defaultLeaseTTL is used by KeepAlive when Config.LeaseTTL is left zero
+const defaultLeaseTTL = 10 * time.Second
+
+// KeepAlive grants the Client a lease and refreshes it for as long as ctx is not canceled, so
+// every field tagged "lease" shares a single expiration instead of its own TTL: if the heartbeat
+// is lost, the whole group expires from etcd together. It requires a backend that supports leases
+// (BackendV3); other backends return ErrLeaseNotSupported.
+//
+// The returned channel is closed once the lease can no longer be kept alive (ctx canceled, or the
+// lease lost or expired), so callers can tell a "set registered" from a "registration lost" state.
+// KeepAlive only grants the lease: call Save (or SaveField) afterwards to actually write the
+// lease-tagged fields attached to it.
+func (c *Client) KeepAlive(ctx context.Context) (<-chan struct{}, error) {
+	granter, ok := c.backend.(leaser)
+	if !ok {
+		return nil, ErrLeaseNotSupported
+	}
+
+	ttl := c.leaseTTL
+	if ttl == 0 {
+		ttl = defaultLeaseTTL
+	}
+
+	leaseID, keptAlive, err := granter.Grant(ctx, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.leaseID = leaseID
+	c.mu.Unlock()
+
+	return keptAlive, nil
+}
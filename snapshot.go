@@ -0,0 +1,221 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// SnapshotEntry is a single leaf key captured by Client.Export, addressed the same full etcd path
+// (including namespace) that Save and Load use, together with the value and version it held at
+// export time.
+type SnapshotEntry struct {
+	Path    string
+	Value   string
+	Version uint64
+}
+
+// Snapshot is a captured copy of every leaf key under a Client's bound prefix, taken by Export and
+// later handed to WriteTo, ReadSnapshot and Restore for a config-file export/import workflow built
+// on top of the same struct-tag model Save and Load already use.
+type Snapshot struct {
+	Namespace string
+	Entries   []SnapshotEntry
+}
+
+// Export walks every key under the Client's bound prefix (c.root, the namespace or the etcd root)
+// and returns a Snapshot capturing each leaf's current value and version. Unlike Save/Load, Export
+// doesn't go through the configuration struct's fields, so it captures whatever is actually stored
+// in etcd even if the bound struct has no field for it.
+func (c *Client) Export(ctx context.Context) (*Snapshot, error) {
+	c.mu.RLock()
+	root, namespace := c.root(), c.namespace
+	c.mu.RUnlock()
+
+	node, err := c.backend.Get(ctx, root, true, true)
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &Snapshot{Namespace: namespace}
+	collectLeaves(node, snap)
+	return snap, nil
+}
+
+// collectLeaves walks node's tree (as returned by a recursive Get), appending a SnapshotEntry for
+// every leaf it finds.
+func collectLeaves(node *Node, snap *Snapshot) {
+	if node == nil {
+		return
+	}
+
+	if node.Dir {
+		for _, child := range node.Nodes {
+			collectLeaves(child, snap)
+		}
+		return
+	}
+
+	snap.Entries = append(snap.Entries, SnapshotEntry{Path: node.Key, Value: node.Value, Version: node.ModifiedIndex})
+}
+
+// WriteTo encodes snap as JSON, YAML or TOML (see format) and writes the result to w.
+func (snap *Snapshot) WriteTo(w io.Writer, format Format) error {
+	switch format {
+	case FormatYAML:
+		return yaml.NewEncoder(w).Encode(snap)
+	case FormatTOML:
+		return toml.NewEncoder(w).Encode(snap)
+	default:
+		return json.NewEncoder(w).Encode(snap)
+	}
+}
+
+// ReadSnapshot decodes a Snapshot previously written by Snapshot.WriteTo back from r.
+func ReadSnapshot(r io.Reader, format Format) (*Snapshot, error) {
+	var snap Snapshot
+	var err error
+
+	switch format {
+	case FormatYAML:
+		err = yaml.NewDecoder(r).Decode(&snap)
+	case FormatTOML:
+		_, err = toml.NewDecoder(r).Decode(&snap)
+	default:
+		err = json.NewDecoder(r).Decode(&snap)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &snap, nil
+}
+
+// RestoreOptions configures Client.Restore.
+type RestoreOptions struct {
+	// Strict makes Restore refuse to overwrite any entry whose version has advanced since snap was
+	// taken, instead aborting the whole Restore and returning a ConflictError listing the paths
+	// that had moved on. The default, false, overwrites every entry unconditionally.
+	Strict bool
+}
+
+// Restore rewrites every entry of snap back to etcd. On a backend that supports multi-key
+// transactions (BackendV3), the whole snapshot is written through a single Txn, so either every
+// key is updated or, on a Strict conflict, none is. Other backends have no such primitive, so
+// entries are written one at a time and, if a later one fails, every entry already written by this
+// Restore is rolled back to the value (or absence) it had beforehand.
+func (c *Client) Restore(ctx context.Context, snap *Snapshot, opts RestoreOptions) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if txn, ok := c.backend.(txner); ok {
+		return c.restoreTxn(ctx, txn, snap, opts)
+	}
+
+	return c.restoreSequential(ctx, snap, opts)
+}
+
+func (c *Client) restoreTxn(ctx context.Context, txn txner, snap *Snapshot, opts RestoreOptions) error {
+	puts := make([]txnPut, len(snap.Entries))
+	var compares []txnCompare
+
+	for i, entry := range snap.Entries {
+		puts[i] = txnPut{Path: entry.Path, Value: entry.Value}
+		if opts.Strict {
+			compares = append(compares, txnCompare{Path: entry.Path, Revision: entry.Version})
+		}
+	}
+
+	succeeded, revision, conflicted, err := txn.Txn(ctx, compares, puts)
+	if err != nil {
+		return err
+	}
+	if !succeeded {
+		return ConflictError{Keys: conflicted}
+	}
+
+	c.refreshRestoredInfo(puts, revision)
+
+	return nil
+}
+
+// refreshRestoredInfo updates c.info's version and value for every restored path a prior Load,
+// Save, SaveField or SaveTxn is already tracking, to the revision Restore just wrote it at;
+// otherwise the tracked version would still point at what was there before the Restore, and the
+// next SaveField, SaveCAS or SaveTxn touching that path would fail with a spurious conflict even
+// though nothing but this Restore had touched it since. Paths Restore wrote that aren't tracked
+// (Export captures raw etcd keys, not just the bound configuration's fields) are left alone.
+func (c *Client) refreshRestoredInfo(puts []txnPut, revision uint64) {
+	for _, put := range puts {
+		fieldInfo, ok := c.info[put.Path]
+		if !ok {
+			continue
+		}
+
+		fieldInfo.version = revision
+		fieldInfo.value = put.Value
+		c.info[put.Path] = fieldInfo
+	}
+}
+
+// restoredEntry remembers what a path held (or that it didn't exist) before restoreSequential
+// overwrote it, so a later failure can roll it back.
+type restoredEntry struct {
+	path    string
+	existed bool
+	value   string
+}
+
+func (c *Client) restoreSequential(ctx context.Context, snap *Snapshot, opts RestoreOptions) error {
+	var written []restoredEntry
+
+	rollback := func() {
+		for i := len(written) - 1; i >= 0; i-- {
+			entry := written[i]
+			if entry.existed {
+				c.backend.Set(ctx, entry.path, entry.value, 0)
+			} else {
+				c.backend.Delete(ctx, entry.path, false)
+			}
+		}
+	}
+
+	for _, entry := range snap.Entries {
+		before, getErr := c.backend.Get(ctx, entry.Path, false, false)
+		existed := getErr == nil
+
+		var node *Node
+		var err error
+
+		if opts.Strict {
+			if node, err = c.backend.CompareAndSwap(ctx, entry.Path, entry.Value, 0, "", entry.Version); err != nil {
+				rollback()
+				return ConflictError{Keys: []string{entry.Path}}
+			}
+		} else if node, err = c.backend.Set(ctx, entry.Path, entry.Value, 0); err != nil {
+			rollback()
+			return err
+		}
+
+		if fieldInfo, ok := c.info[entry.Path]; ok {
+			fieldInfo.version = node.ModifiedIndex
+			fieldInfo.value = entry.Value
+			c.info[entry.Path] = fieldInfo
+		}
+
+		restored := restoredEntry{path: entry.Path, existed: existed}
+		if existed {
+			restored.value = before.Value
+		}
+		written = append(written, restored)
+	}
+
+	return nil
+}
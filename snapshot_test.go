@@ -0,0 +1,149 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+)
+
+func newSnapshotClient() *Client {
+	return &Client{
+		backend: newV2Backend(NewClientMock()),
+		config: reflect.ValueOf(&struct {
+			A string `etcd:"/a"`
+			B string `etcd:"/b"`
+		}{A: "1", B: "2"}),
+		info:      make(map[string]info),
+		codecs:    defaultCodecs(),
+		namespace: "/ns",
+	}
+}
+
+func TestExport(t *testing.T) {
+	c := newSnapshotClient()
+
+	if err := c.Save(context.Background()); err != nil {
+		t.Fatalf("unexpected error saving configuration: %s", err)
+	}
+
+	snap, err := c.Export(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error exporting snapshot: %s", err)
+	}
+
+	if snap.Namespace != "/ns" {
+		t.Errorf("expected namespace “/ns”, found “%s”", snap.Namespace)
+	}
+	if len(snap.Entries) != 2 {
+		t.Fatalf("expected 2 entries, found %d (%+v)", len(snap.Entries), snap.Entries)
+	}
+}
+
+func TestSnapshotWriteToReadSnapshot(t *testing.T) {
+	data := []struct {
+		description string
+		format      Format
+	}{
+		{
+			description: "it should round-trip a snapshot through JSON",
+			format:      FormatJSON,
+		},
+		{
+			description: "it should round-trip a snapshot through YAML",
+			format:      FormatYAML,
+		},
+		{
+			description: "it should round-trip a snapshot through TOML",
+			format:      FormatTOML,
+		},
+	}
+
+	for i, item := range data {
+		snap := &Snapshot{
+			Namespace: "/ns",
+			Entries: []SnapshotEntry{
+				{Path: "/ns/a", Value: "1", Version: 3},
+				{Path: "/ns/b", Value: "2", Version: 5},
+			},
+		}
+
+		var buf bytes.Buffer
+		if err := snap.WriteTo(&buf, item.format); err != nil {
+			t.Errorf("Item %d, “%s”: unexpected error writing snapshot: %s", i, item.description, err)
+			continue
+		}
+
+		got, err := ReadSnapshot(&buf, item.format)
+		if err != nil {
+			t.Errorf("Item %d, “%s”: unexpected error reading snapshot: %s", i, item.description, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, snap) {
+			t.Errorf("Item %d, “%s”: round-trip mismatch. Expecting “%+v”; found “%+v”",
+				i, item.description, snap, got)
+		}
+	}
+}
+
+func TestRestoreRefreshesTrackedInfo(t *testing.T) {
+	c := newSnapshotClient()
+
+	if err := c.Save(context.Background()); err != nil {
+		t.Fatalf("unexpected error saving configuration: %s", err)
+	}
+
+	snap, err := c.Export(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error exporting snapshot: %s", err)
+	}
+	for i := range snap.Entries {
+		if snap.Entries[i].Path == "/ns/a" {
+			snap.Entries[i].Value = "restored"
+		}
+	}
+
+	if err := c.Restore(context.Background(), snap, RestoreOptions{}); err != nil {
+		t.Fatalf("unexpected error restoring: %s", err)
+	}
+
+	// Restore bypasses the bound configuration struct, so c.info must be refreshed directly from
+	// what was written; otherwise this SaveField would fail against the version it held before the
+	// Restore even though nothing else touched "/a" since
+	a := c.config.Elem().FieldByName("A").Addr().Interface().(*string)
+	*a = "saved-after-restore"
+	if err := c.SaveField(context.Background(), a); err != nil {
+		t.Fatalf("expected SaveField to succeed against the version Restore left behind, found: %s", err)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	c := newSnapshotClient()
+
+	if err := c.Save(context.Background()); err != nil {
+		t.Fatalf("unexpected error saving configuration: %s", err)
+	}
+
+	snap, err := c.Export(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error exporting snapshot: %s", err)
+	}
+
+	if err := c.Restore(context.Background(), snap, RestoreOptions{Strict: true}); err != nil {
+		t.Fatalf("unexpected error restoring against the version it was exported at: %s", err)
+	}
+
+	if err := c.Restore(context.Background(), snap, RestoreOptions{}); err != nil {
+		t.Fatalf("unexpected error restoring unconditionally: %s", err)
+	}
+
+	err = c.Restore(context.Background(), snap, RestoreOptions{Strict: true})
+	if _, ok := err.(ConflictError); !ok {
+		t.Fatalf("expected ConflictError restoring stale versions, found %T (%v)", err, err)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"strings"
+	"time"
+)
+
+// tagOptions holds the comma-separated options that can follow the path in an etcd struct tag,
+// e.g. `etcd:"/path,ttl=30s,codec=json,omitempty"`
+type tagOptions struct {
+	// TTL, when non-zero, is passed along to Set and CreateInOrder so the key expires on its own
+	// instead of living forever; the directories Save creates for struct, slice and map fields get
+	// no TTL
+	TTL time.Duration
+
+	// Codec names a codec registered on the Client (see Client.RegisterCodec) used to marshal and
+	// unmarshal the field instead of the built-in scalar handling. When empty, time.Duration,
+	// time.Time, net.IP, *url.URL and types implementing encoding.TextMarshaler are still picked up
+	// automatically. The bare "json" tag option is shorthand for "codec=json": on a struct, map or
+	// slice field it stores the whole subtree as one JSON-encoded value instead of exploding it into
+	// child keys
+	Codec string
+
+	// OmitEmpty skips writing the field during Save when it holds its zero value
+	OmitEmpty bool
+
+	// Lease marks the field as part of the Client's shared lease (see Client.KeepAlive) instead of
+	// carrying its own TTL. It is mutually exclusive with TTL: a field either expires on its own or
+	// expires together with the rest of the lease group when its heartbeat is lost
+	Lease bool
+
+	// ACL names the role required to read this field during Load. It only has an effect when the
+	// Client carries an AuthProvider (see Client.WithAuth); a field with no "acl" option is never
+	// filtered
+	ACL string
+
+	// Hidden marks the field as hidden the same way a "_"-prefixed path is, for a field kept outside
+	// that naming convention. See Client.WithHiddenPolicy
+	Hidden bool
+}
+
+// parseTag splits an etcd struct tag into its path and options. An empty tag (no "etcd" key, or an
+// empty value) yields an empty path, which callers treat as "field not managed by etcetera".
+// Unrecognized or malformed options are silently ignored, the same way an empty tag is.
+func parseTag(tag string) (string, tagOptions) {
+	parts := strings.Split(tag, ",")
+
+	var opts tagOptions
+	for _, part := range parts[1:] {
+		switch {
+		case part == "omitempty":
+			opts.OmitEmpty = true
+
+		case part == "lease":
+			opts.Lease = true
+
+		case part == "hidden":
+			opts.Hidden = true
+
+		case part == "json":
+			if len(opts.Codec) == 0 {
+				opts.Codec = "json"
+			}
+
+		case strings.HasPrefix(part, "ttl="):
+			if ttl, err := time.ParseDuration(strings.TrimPrefix(part, "ttl=")); err == nil {
+				opts.TTL = ttl
+			}
+
+		case strings.HasPrefix(part, "codec="):
+			opts.Codec = strings.TrimPrefix(part, "codec=")
+
+		case strings.HasPrefix(part, "acl="):
+			opts.ACL = strings.TrimPrefix(part, "acl=")
+		}
+	}
+
+	return parts[0], opts
+}
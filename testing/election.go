@@ -0,0 +1,46 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rafaeljusto/etcetera"
+)
+
+func main() {
+	etc, err := etcetera.NewClient([]string{
+		"http://127.0.0.1:4001",
+		"http://127.0.0.1:4002",
+		"http://127.0.0.1:4003",
+	}, &struct{}{})
+
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	election := etcetera.NewElection(etc)
+
+	lease, err := election.Campaign(ctx, "/services/worker/leader", "worker-1", 10*time.Second)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	go func() {
+		for identity := range lease.Observe(ctx) {
+			fmt.Printf("leader is now %s\n", identity)
+		}
+	}()
+
+	<-lease.Done()
+	fmt.Println("lease lost")
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/rafaeljusto/etcetera"
@@ -39,7 +40,7 @@ func main() {
 		return
 	}
 
-	if err := etc.Load(); err != nil {
+	if err := etc.Load(context.Background()); err != nil {
 		fmt.Println(err)
 		return
 	}
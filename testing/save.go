@@ -5,6 +5,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/rafaeljusto/etcetera"
@@ -56,7 +57,7 @@ func main() {
 		return
 	}
 
-	if err := etc.Save(); err != nil {
+	if err := etc.Save(context.Background()); err != nil {
 		fmt.Println(err)
 		return
 	}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/rafaeljusto/etcetera"
@@ -39,36 +40,36 @@ func main() {
 		return
 	}
 
-	if err := etc.Load(); err != nil {
+	if err := etc.Load(context.Background()); err != nil {
 		fmt.Println(err)
 		return
 	}
 
-	key1, err := etc.Version(&config.Key1)
+	key1, err := etc.Version(context.Background(), &config.Key1)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
 
-	key1Subkey1, err := etc.Version(&config.Key1.Subkey1)
+	key1Subkey1, err := etc.Version(context.Background(), &config.Key1.Subkey1)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
 
-	key1Subkey2, err := etc.Version(&config.Key1.Subkey2)
+	key1Subkey2, err := etc.Version(context.Background(), &config.Key1.Subkey2)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
 
-	key2, err := etc.Version(&config.Key2)
+	key2, err := etc.Version(context.Background(), &config.Key2)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
 
-	key3, err := etc.Version(&config.Key3)
+	key3, err := etc.Version(context.Background(), &config.Key3)
 	if err != nil {
 		fmt.Println(err)
 		return
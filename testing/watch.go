@@ -5,6 +5,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/rafaeljusto/etcetera"
@@ -43,12 +44,12 @@ func main() {
 		return
 	}
 
-	if err := etc.Load(); err != nil {
+	if err := etc.Load(context.Background()); err != nil {
 		fmt.Println(err)
 		return
 	}
 
-	_, err = etc.Watch(&config.Key1, func() {
+	_, err = etc.Watch(context.Background(), &config.Key1, func() {
 		fmt.Printf("Key1 changed: %+v\n", config.Key1)
 	})
 
@@ -57,7 +58,7 @@ func main() {
 		return
 	}
 
-	_, err = etc.Watch(&config.Key2, func() {
+	_, err = etc.Watch(context.Background(), &config.Key2, func() {
 		fmt.Printf("Key2 changed: %+v\n", config.Key2)
 	})
 
@@ -66,7 +67,7 @@ func main() {
 		return
 	}
 
-	_, err = etc.Watch(&config.Key3, func() {
+	_, err = etc.Watch(context.Background(), &config.Key3, func() {
 		fmt.Printf("Key3 changed: %+v\n", config.Key3)
 	})
 
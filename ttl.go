@@ -0,0 +1,148 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// ttlItem is a single tracked key in a ttlTracker's heap
+type ttlItem struct {
+	path     string
+	expireAt time.Time
+	index    int
+}
+
+// ttlHeap implements container/heap.Interface ordered by expireAt, earliest first, mirroring the
+// ttl_key_heap design etcd's own store uses to know which key expires next without scanning all of
+// them
+type ttlHeap []*ttlItem
+
+func (h ttlHeap) Len() int { return len(h) }
+
+func (h ttlHeap) Less(i, j int) bool { return h[i].expireAt.Before(h[j].expireAt) }
+
+func (h ttlHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *ttlHeap) Push(x interface{}) {
+	item := x.(*ttlItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *ttlHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.index = -1
+	*h = old[:n-1]
+	return item
+}
+
+// ttlTracker keeps a min-heap of every key saved with a non-zero TTL, keyed by the time it would
+// expire, alongside a map[path]*ttlItem so re-saving (or deleting) an already tracked key finds and
+// updates its heap entry in O(log n) instead of a linear scan.
+type ttlTracker struct {
+	mu       sync.Mutex
+	items    ttlHeap
+	index    map[string]*ttlItem
+	wake     chan struct{}
+	onExpire func(path string)
+}
+
+func newTTLTracker(onExpire func(path string)) *ttlTracker {
+	return &ttlTracker{
+		index:    make(map[string]*ttlItem),
+		wake:     make(chan struct{}, 1),
+		onExpire: onExpire,
+	}
+}
+
+// track records that path expires ttl from now, replacing its previous entry (if any) so re-saving
+// a key pushes its expiry back out instead of leaving a stale, earlier one in the heap.
+func (t *ttlTracker) track(path string, ttl time.Duration) {
+	t.mu.Lock()
+	expireAt := time.Now().Add(ttl)
+
+	if item, ok := t.index[path]; ok {
+		item.expireAt = expireAt
+		heap.Fix(&t.items, item.index)
+	} else {
+		item := &ttlItem{path: path, expireAt: expireAt}
+		heap.Push(&t.items, item)
+		t.index[path] = item
+	}
+	t.mu.Unlock()
+
+	t.nudge()
+}
+
+// untrack drops path from the heap, if present, so a key removed by Delete before its TTL elapsed
+// never fires onExpire.
+func (t *ttlTracker) untrack(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	item, ok := t.index[path]
+	if !ok {
+		return
+	}
+
+	heap.Remove(&t.items, item.index)
+	delete(t.index, path)
+}
+
+// nudge wakes run's sleep early, used whenever track pushes a new earliest deadline onto the heap.
+func (t *ttlTracker) nudge() {
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run sleeps until the earliest tracked key would expire, pops it, calls onExpire, and repeats,
+// until ctx is canceled. An idle tracker (nothing pushed yet) just waits on wake or ctx.
+func (t *ttlTracker) run(ctx context.Context) {
+	for {
+		t.mu.Lock()
+		var ready *ttlItem
+		wait := time.Hour
+
+		if t.items.Len() > 0 {
+			if until := time.Until(t.items[0].expireAt); until <= 0 {
+				ready = heap.Pop(&t.items).(*ttlItem)
+				delete(t.index, ready.path)
+			} else {
+				wait = until
+			}
+		}
+		t.mu.Unlock()
+
+		if ready != nil {
+			t.onExpire(ready.path)
+			continue
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+
+		case <-t.wake:
+			timer.Stop()
+
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTTLTrackerPopOrder(t *testing.T) {
+	var fired []string
+	done := make(chan struct{})
+
+	tracker := newTTLTracker(func(path string) {
+		fired = append(fired, path)
+		if len(fired) == 3 {
+			close(done)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go tracker.run(ctx)
+
+	// Tracked out of order; they must fire in expireAt order (shortest TTL first), not push order.
+	tracker.track("/field2", 30*time.Millisecond)
+	tracker.track("/field1", 10*time.Millisecond)
+	tracker.track("/field3", 50*time.Millisecond)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for all keys to expire")
+	}
+
+	expected := []string{"/field1", "/field2", "/field3"}
+	if len(fired) != len(expected) {
+		t.Fatalf("expected %d callbacks, got %d (%v)", len(expected), len(fired), fired)
+	}
+
+	for i, path := range expected {
+		if fired[i] != path {
+			t.Errorf("position %d: expected %q, found %q (full order: %v)", i, path, fired[i], fired)
+		}
+	}
+}
+
+func TestTTLTrackerUntrack(t *testing.T) {
+	fired := make(chan string, 1)
+
+	tracker := newTTLTracker(func(path string) {
+		fired <- path
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go tracker.run(ctx)
+
+	tracker.track("/removed", 10*time.Millisecond)
+	tracker.track("/kept", 30*time.Millisecond)
+	tracker.untrack("/removed")
+
+	select {
+	case path := <-fired:
+		if path != "/kept" {
+			t.Errorf("expected /kept to fire, found %q", path)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for /kept to expire")
+	}
+
+	select {
+	case path := <-fired:
+		t.Errorf("untracked key /removed fired unexpectedly (%q)", path)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestTTLTrackerReTrackDelaysExpiry(t *testing.T) {
+	fired := make(chan string, 1)
+
+	tracker := newTTLTracker(func(path string) {
+		fired <- path
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go tracker.run(ctx)
+
+	tracker.track("/field", 20*time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	tracker.track("/field", 100*time.Millisecond) // re-saved before it expired, pushing it back out
+
+	select {
+	case <-fired:
+		t.Fatal("expired before the re-saved TTL elapsed")
+	case <-time.After(30 * time.Millisecond):
+	}
+
+	select {
+	case path := <-fired:
+		if path != "/field" {
+			t.Errorf("expected /field, found %q", path)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the re-saved TTL to elapse")
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	// ErrTxnNotSupported is returned by SaveTxn when the backend has no notion of a multi-key
+	// transaction. Only BackendV3 satisfies txner today
+	ErrTxnNotSupported = errors.New("etcetera: backend does not support transactional save")
+
+	// ErrTxnSliceNotSupported is returned by SaveTxn when the configuration has a slice field.
+	// Slice elements are written under in-order keys generated at write time (see CreateInOrder),
+	// so there is no previous revision for SaveTxn to guard them with
+	ErrTxnSliceNotSupported = errors.New("etcetera: SaveTxn does not support slice fields")
+
+	// ErrInvalidMaxAttempts is returned by SaveWithRetry and Update when maxAttempts is less than
+	// 1, instead of the loop silently never running SaveTxn/mutate and returning a nil error
+	ErrInvalidMaxAttempts = errors.New("etcetera: maxAttempts must be at least 1")
+)
+
+// ConflictError is returned by SaveTxn when at least one guarded key no longer matches the
+// ModRevision it had at the last Load, SaveField or SaveTxn; nothing was written. Keys lists
+// every path that changed, so the caller knows exactly what to Load again before retrying.
+type ConflictError struct {
+	Keys []string
+}
+
+func (e ConflictError) Error() string {
+	return fmt.Sprintf("etcetera: configuration was modified concurrently on %s, reload before retrying", strings.Join(e.Keys, ", "))
+}
+
+// txnBatch accumulates the guarded writes collectTxnOps finds while walking the configuration, so
+// SaveTxn can hand them to the backend in one call and, once they are known to have succeeded,
+// update c.info from the field and codec recorded alongside each path.
+type txnBatch struct {
+	compares []txnCompare
+	puts     []txnPut
+	fields   map[string]reflect.Value
+	codecs   map[string]string
+}
+
+func newTxnBatch() *txnBatch {
+	return &txnBatch{
+		fields: make(map[string]reflect.Value),
+		codecs: make(map[string]string),
+	}
+}
+
+func (b *txnBatch) add(c *Client, path, value string, ttl uint64, field reflect.Value, codec string) {
+	b.compares = append(b.compares, txnCompare{Path: path, Revision: c.info[path].version})
+	b.puts = append(b.puts, txnPut{Path: path, Value: value, TTL: ttl})
+	b.fields[path] = field
+	b.codecs[path] = codec
+}
+
+// SaveTxn writes every scalar field of the bound configuration (including those nested in structs
+// and the entries of map fields) to etcd in a single all-or-nothing transaction, each key guarded
+// by the ModRevision it had at the last Load, SaveField or SaveTxn. A field never previously read
+// guards on revision 0, i.e. the key must not already exist; Save records no revision either, so a
+// key last written by a plain Save is guarded on revision 0 as well. If any guarded key changed in
+// the meantime, nothing is written and a ConflictError listing the affected keys is returned.
+//
+// SaveTxn requires a backend that supports multi-key transactions (BackendV3); other backends
+// return ErrTxnNotSupported. Slice fields aren't supported either: a slice's in-order keys are
+// generated at write time by CreateInOrder, so there is no previous revision to guard them with.
+func (c *Client) SaveTxn(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	txn, ok := c.backend.(txner)
+	if !ok {
+		return ErrTxnNotSupported
+	}
+
+	batch := newTxnBatch()
+	if err := c.collectTxnOps(c.config, c.namespace, batch); err != nil {
+		return err
+	}
+
+	succeeded, revision, conflicted, err := txn.Txn(ctx, batch.compares, batch.puts)
+	if err != nil {
+		return err
+	}
+	if !succeeded {
+		return ConflictError{Keys: conflicted}
+	}
+
+	for _, put := range batch.puts {
+		c.info[put.Path] = info{
+			field:   batch.fields[put.Path],
+			version: revision,
+			value:   put.Value,
+			codec:   batch.codecs[put.Path],
+		}
+	}
+
+	return nil
+}
+
+// SaveWithRetry calls SaveTxn, and on a ConflictError reloads the configuration and tries again, up
+// to maxAttempts times. It returns the last ConflictError if every attempt conflicts, or whatever
+// other error Load or SaveTxn produced along the way. maxAttempts must be at least 1; otherwise
+// ErrInvalidMaxAttempts is returned instead of silently never calling SaveTxn at all.
+func (c *Client) SaveWithRetry(ctx context.Context, maxAttempts int) error {
+	if maxAttempts < 1 {
+		return ErrInvalidMaxAttempts
+	}
+
+	var err error
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		err = c.SaveTxn(ctx)
+		if err == nil {
+			return nil
+		}
+
+		if _, ok := err.(ConflictError); !ok {
+			return err
+		}
+
+		if loadErr := c.Load(ctx); loadErr != nil {
+			return loadErr
+		}
+	}
+
+	return err
+}
+
+// Update reads the version field is currently tracked at (from a prior Load, Save, SaveField,
+// SaveCAS, DeleteCAS or Watch), calls mutate to change field's local Go value, and writes it back
+// with SaveField. If someone else changed the field in etcd first, it reloads the whole
+// configuration and tries again, up to maxAttempts times, the same way SaveWithRetry does for
+// SaveTxn - which makes it suitable for a shared counter or any other value multiple processes
+// update concurrently. It returns the last ErrStaleVersion if every attempt conflicts, or whatever
+// other error Load, mutate or SaveField produced along the way. maxAttempts must be at least 1;
+// otherwise ErrInvalidMaxAttempts is returned instead of silently never calling mutate at all.
+func (c *Client) Update(ctx context.Context, field interface{}, maxAttempts int, mutate func() error) error {
+	if maxAttempts < 1 {
+		return ErrInvalidMaxAttempts
+	}
+
+	var err error
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if err = mutate(); err != nil {
+			return err
+		}
+
+		err = c.SaveField(ctx, field)
+		if err == nil {
+			return nil
+		}
+
+		if _, ok := err.(ErrStaleVersion); !ok {
+			return err
+		}
+
+		if loadErr := c.Load(ctx); loadErr != nil {
+			return loadErr
+		}
+	}
+
+	return err
+}
+
+// collectTxnOps walks config the same way save does, but instead of writing each field it appends
+// a guarded put to batch.
+func (c *Client) collectTxnOps(config reflect.Value, pathSuffix string, batch *txnBatch) error {
+	config = config.Elem()
+
+	for i := 0; i < config.NumField(); i++ {
+		field := config.Field(i)
+		fieldType := config.Type().Field(i)
+
+		path, opts := parseTag(fieldType.Tag.Get("etcd"))
+		if len(path) == 0 {
+			continue
+		}
+		path = pathSuffix + path
+
+		writeField := field
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				continue
+			}
+			writeField = field.Elem()
+		}
+
+		if opts.OmitEmpty && writeField.IsZero() {
+			continue
+		}
+
+		ttl := uint64(opts.TTL.Seconds())
+
+		if codec, ok := c.resolveCodec(writeField, opts.Codec); ok {
+			value, err := codec.Marshal(writeField)
+			if err != nil {
+				return err
+			}
+
+			batch.add(c, path, value, ttl, field, opts.Codec)
+			continue
+		}
+
+		switch writeField.Kind() {
+		case reflect.Struct:
+			if err := c.collectTxnOps(writeField.Addr(), path, batch); err != nil {
+				return err
+			}
+
+		case reflect.Map:
+			for _, key := range writeField.MapKeys() {
+				keyPath := path + "/" + key.String()
+				batch.add(c, keyPath, writeField.MapIndex(key).String(), ttl, field, "")
+			}
+
+		case reflect.Slice:
+			return ErrTxnSliceNotSupported
+
+		default:
+			value, ok := scalarString(writeField)
+			if !ok {
+				continue
+			}
+			batch.add(c, path, value, ttl, field, "")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/coreos/go-etcd/etcd"
+)
+
+// v2Backend adapts the go-etcd (Keys API v2) client to the kv interface. This client predates
+// context.Context, so every method ignores the ctx argument it receives: cancellation and
+// deadlines are only honored by the BackendKeysAPI backend.
+type v2Backend struct {
+	client client
+}
+
+func newV2Backend(c client) *v2Backend {
+	return &v2Backend{client: c}
+}
+
+// newV2BackendWithConfig builds the real go-etcd client newBackend wires up for BackendV2,
+// applying cfg.TLS, cfg.Username/Password and cfg.DialTimeout to it the same way newKeysAPIBackend
+// and newV3Backend already do for their own clients.
+func newV2BackendWithConfig(cfg Config) (*v2Backend, error) {
+	c := etcd.NewClient(cfg.Endpoints)
+
+	if cfg.TLS != nil {
+		c.SetTransport(&http.Transport{TLSClientConfig: cfg.TLS})
+	}
+
+	if len(cfg.Username) > 0 {
+		c.SetCredentials(cfg.Username, cfg.Password)
+	}
+
+	if cfg.DialTimeout > 0 {
+		c.SetDialTimeout(cfg.DialTimeout)
+	}
+
+	return newV2Backend(newV2Client(c)), nil
+}
+
+func (b *v2Backend) Get(ctx context.Context, path string, sort, recursive bool) (*Node, error) {
+	resp, err := b.client.Get(path, sort, recursive)
+	if err != nil {
+		return nil, err
+	}
+	return nodeFromEtcd(resp.Node), nil
+}
+
+func (b *v2Backend) Set(ctx context.Context, path, value string, ttl uint64) (*Node, error) {
+	resp, err := b.client.Set(path, value, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return nodeFromEtcd(resp.Node), nil
+}
+
+func (b *v2Backend) Create(ctx context.Context, path, value string, ttl uint64) (*Node, error) {
+	resp, err := b.client.Create(path, value, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return nodeFromEtcd(resp.Node), nil
+}
+
+func (b *v2Backend) CreateDir(ctx context.Context, path string, ttl uint64) (*Node, error) {
+	resp, err := b.client.CreateDir(path, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return nodeFromEtcd(resp.Node), nil
+}
+
+func (b *v2Backend) CreateInOrder(ctx context.Context, path, value string, ttl uint64) (*Node, error) {
+	resp, err := b.client.CreateInOrder(path, value, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return nodeFromEtcd(resp.Node), nil
+}
+
+func (b *v2Backend) Delete(ctx context.Context, path string, recursive bool) (*Node, error) {
+	resp, err := b.client.Delete(path, recursive)
+	if err != nil {
+		return nil, err
+	}
+	return nodeFromEtcd(resp.Node), nil
+}
+
+func (b *v2Backend) CompareAndSwap(ctx context.Context, path, value string, ttl uint64, prevValue string, prevIndex uint64) (*Node, error) {
+	resp, err := b.client.CompareAndSwap(path, value, ttl, prevValue, prevIndex)
+	if err != nil {
+		return nil, err
+	}
+	return nodeFromEtcd(resp.Node), nil
+}
+
+func (b *v2Backend) CompareAndDelete(ctx context.Context, path, prevValue string, prevIndex uint64) (*Node, error) {
+	resp, err := b.client.CompareAndDelete(path, prevValue, prevIndex)
+	if err != nil {
+		return nil, err
+	}
+	return nodeFromEtcd(resp.Node), nil
+}
+
+// Health reports what each machine this backend's client knows about says about the cluster it
+// belongs to. See client.Members for why a real connection only ever reports the pool as a whole.
+func (b *v2Backend) Health(ctx context.Context) (ClusterHealth, error) {
+	return clusterHealthFromMembers(b.client.Members()), nil
+}
+
+func (b *v2Backend) Watch(ctx context.Context, path string, waitIndex uint64, recursive bool, receiver chan *Node, stop chan bool) (*Node, error) {
+	etcdReceiver := make(chan *etcd.Response)
+	go forwardEtcdResponses(etcdReceiver, receiver, stop)
+
+	resp, err := b.client.Watch(path, waitIndex, recursive, etcdReceiver, stop)
+	if err != nil || resp == nil {
+		return nil, err
+	}
+	return nodeFromEtcdResponse(resp), nil
+}
+
+// forwardEtcdResponses relays raw go-etcd responses arriving on in to the backend-agnostic out
+// channel until in is closed or stop fires.
+func forwardEtcdResponses(in chan *etcd.Response, out chan *Node, stop chan bool) {
+	for {
+		select {
+		case resp, ok := <-in:
+			if !ok {
+				return
+			}
+			if resp == nil {
+				out <- nil
+			} else {
+				out <- nodeFromEtcdResponse(resp)
+			}
+
+		case <-stop:
+			return
+		}
+	}
+}
+
+// nodeFromEtcd converts a go-etcd node (and its children) into the backend-agnostic Node type.
+func nodeFromEtcd(n *etcd.Node) *Node {
+	if n == nil {
+		return nil
+	}
+
+	node := &Node{
+		Key:           n.Key,
+		Value:         n.Value,
+		Dir:           n.Dir,
+		ModifiedIndex: n.ModifiedIndex,
+	}
+
+	for _, child := range n.Nodes {
+		node.Nodes = append(node.Nodes, nodeFromEtcd(child))
+	}
+
+	return node
+}
+
+// nodeFromEtcdResponse converts a go-etcd watch response into a Node, also carrying the action
+// that triggered it and the value the key held beforehand (when available).
+func nodeFromEtcdResponse(resp *etcd.Response) *Node {
+	node := nodeFromEtcd(resp.Node)
+	if node == nil {
+		return nil
+	}
+
+	node.Action = resp.Action
+	if resp.PrevNode != nil {
+		node.PrevValue = resp.PrevNode.Value
+	}
+
+	return node
+}
@@ -0,0 +1,474 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// v3Client is the slice of *clientv3.Client's behavior v3Backend depends on: the KV, Lease and
+// Watcher facets, narrowed to the handful of methods actually called. *clientv3.Client satisfies it
+// directly (it embeds all three), so production code passes one in unchanged; tests substitute a
+// lightweight fake instead of dialing a real etcd 3.x cluster.
+type v3Client interface {
+	Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error)
+	Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error)
+	Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error)
+	Txn(ctx context.Context) clientv3.Txn
+	Grant(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error)
+	KeepAlive(ctx context.Context, id clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error)
+	Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan
+}
+
+// v3Backend adapts the gRPC-based go.etcd.io/etcd/client/v3 client to the kv interface, so a Client
+// can talk to a modern etcd 3.x cluster with the same struct-tag reflection machinery used against
+// go-etcd (v2Backend) and the KeysAPI client (keysAPIBackend). Unlike those two, etcd 3.x keeps a
+// flat keyspace instead of a directory tree, so Get reconstructs the Node hierarchy Save/Load/Watch
+// expect from the list of keys sharing a path's prefix, and TTL is implemented through leases
+// instead of a per-key expiry argument.
+type v3Backend struct {
+	client v3Client
+}
+
+func newV3Backend(cfg Config) (*v3Backend, error) {
+	c, err := clientv3.New(clientv3.Config{
+		Endpoints:   cfg.Endpoints,
+		DialTimeout: cfg.DialTimeout,
+		Username:    cfg.Username,
+		Password:    cfg.Password,
+		TLS:         cfg.TLS,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &v3Backend{client: c}, nil
+}
+
+func (b *v3Backend) Get(ctx context.Context, path string, sort, recursive bool) (*Node, error) {
+	// The exact key is tried first (and alone) because clientv3.WithPrefix matches on raw byte
+	// prefix, so a plain prefix query for "/a" would also match a sibling key like "/ab"
+	resp, err := b.client.Get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Kvs) == 1 {
+		kv := resp.Kvs[0]
+		return &Node{Key: path, Value: string(kv.Value), ModifiedIndex: uint64(kv.ModRevision)}, nil
+	}
+
+	if !recursive {
+		return nil, notFoundError(path)
+	}
+
+	opts := []clientv3.OpOption{clientv3.WithPrefix()}
+	if sort {
+		opts = append(opts, clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	}
+
+	childResp, err := b.client.Get(ctx, strings.TrimSuffix(path, "/")+"/", opts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(childResp.Kvs) == 0 {
+		return nil, notFoundError(path)
+	}
+
+	return nodeTreeFromKVs(path, childResp.Kvs), nil
+}
+
+func (b *v3Backend) Set(ctx context.Context, path, value string, ttl uint64) (*Node, error) {
+	opts, err := b.leaseOption(ctx, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := b.client.Put(ctx, path, value, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Node{Key: path, Value: value, ModifiedIndex: uint64(resp.Header.Revision)}, nil
+}
+
+// Grant satisfies the leaser interface: it creates a lease and keeps it alive until ctx is
+// canceled or the lease is lost, at which point the returned channel is closed.
+func (b *v3Backend) Grant(ctx context.Context, ttl time.Duration) (int64, <-chan struct{}, error) {
+	lease, err := b.client.Grant(ctx, int64(ttl.Seconds()))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	respCh, err := b.client.KeepAlive(ctx, lease.ID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	keptAlive := make(chan struct{})
+	go func() {
+		defer close(keptAlive)
+		for range respCh {
+		}
+	}()
+
+	return int64(lease.ID), keptAlive, nil
+}
+
+// SetWithLease satisfies the leaser interface, attaching path to a lease previously returned by
+// Grant instead of granting path its own.
+func (b *v3Backend) SetWithLease(ctx context.Context, path, value string, leaseID int64) (*Node, error) {
+	resp, err := b.client.Put(ctx, path, value, clientv3.WithLease(clientv3.LeaseID(leaseID)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Node{Key: path, Value: value, ModifiedIndex: uint64(resp.Header.Revision)}, nil
+}
+
+func (b *v3Backend) Create(ctx context.Context, path, value string, ttl uint64) (*Node, error) {
+	opts, err := b.leaseOption(ctx, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := b.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(path), "=", 0)).
+		Then(clientv3.OpPut(path, value, opts...)).
+		Commit()
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Succeeded {
+		return nil, alreadyExistsErr(path)
+	}
+
+	return &Node{Key: path, Value: value, ModifiedIndex: uint64(resp.Header.Revision)}, nil
+}
+
+// CreateDir is a no-op that always succeeds: etcd 3.x has no directory keys, a path only exists
+// because some descendant key happens to share its prefix
+func (b *v3Backend) CreateDir(ctx context.Context, path string, ttl uint64) (*Node, error) {
+	return &Node{Key: path, Dir: true}, nil
+}
+
+// CreateInOrder writes value under a key suffixed with the cluster's current revision, retrying
+// with a freshly observed revision whenever a concurrent CreateInOrder landed on the same key
+// first: the revision read to build the candidate key is never more than a guess, since nothing
+// stops another caller from reading the same one before either of them writes, so the write
+// itself is guarded by a Txn that only succeeds if the key is still absent (mirroring Create).
+func (b *v3Backend) CreateInOrder(ctx context.Context, path, value string, ttl uint64) (*Node, error) {
+	opts, err := b.leaseOption(ctx, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := strings.TrimSuffix(path, "/")
+
+	for {
+		resp, err := b.client.Get(ctx, prefix, clientv3.WithCountOnly())
+		if err != nil {
+			return nil, err
+		}
+
+		key := fmt.Sprintf("%s/%020d", prefix, resp.Header.Revision)
+
+		txnResp, err := b.client.Txn(ctx).
+			If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+			Then(clientv3.OpPut(key, value, opts...)).
+			Commit()
+		if err != nil {
+			return nil, err
+		}
+		if !txnResp.Succeeded {
+			continue
+		}
+
+		return &Node{Key: key, Value: value, ModifiedIndex: uint64(txnResp.Header.Revision)}, nil
+	}
+}
+
+func (b *v3Backend) Delete(ctx context.Context, path string, recursive bool) (*Node, error) {
+	if recursive {
+		if _, err := b.client.Delete(ctx, strings.TrimSuffix(path, "/")+"/", clientv3.WithPrefix()); err != nil {
+			return nil, err
+		}
+		return &Node{Key: path, Dir: true}, nil
+	}
+
+	resp, err := b.client.Delete(ctx, path, clientv3.WithPrevKV())
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.PrevKvs) == 0 {
+		return nil, notFoundError(path)
+	}
+
+	return &Node{Key: path, Value: string(resp.PrevKvs[0].Value)}, nil
+}
+
+func (b *v3Backend) CompareAndSwap(ctx context.Context, path, value string, ttl uint64, prevValue string, prevIndex uint64) (*Node, error) {
+	opts, err := b.leaseOption(ctx, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := b.client.Txn(ctx).
+		If(casComparisons(path, prevValue, prevIndex)...).
+		Then(clientv3.OpPut(path, value, opts...)).
+		Else(clientv3.OpGet(path)).
+		Commit()
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Succeeded {
+		return nil, testFailedError(path, currentModRevision(resp))
+	}
+
+	return &Node{Key: path, Value: value, ModifiedIndex: uint64(resp.Header.Revision)}, nil
+}
+
+func (b *v3Backend) CompareAndDelete(ctx context.Context, path, prevValue string, prevIndex uint64) (*Node, error) {
+	resp, err := b.client.Txn(ctx).
+		If(casComparisons(path, prevValue, prevIndex)...).
+		Then(clientv3.OpDelete(path)).
+		Else(clientv3.OpGet(path)).
+		Commit()
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Succeeded {
+		return nil, testFailedError(path, currentModRevision(resp))
+	}
+
+	return &Node{Key: path}, nil
+}
+
+// Txn commits every put in a single etcd transaction, guarded by an If clause that requires each
+// compared key to still be at its expected ModRevision. When the If clause fails, the Else branch
+// re-reads each compared key so the caller can be told exactly which ones no longer matched. It
+// satisfies the txner interface, making Client.SaveTxn available on this backend.
+func (b *v3Backend) Txn(ctx context.Context, compares []txnCompare, puts []txnPut) (bool, uint64, []string, error) {
+	cmps := make([]clientv3.Cmp, 0, len(compares))
+	for _, cmp := range compares {
+		cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(cmp.Path), "=", int64(cmp.Revision)))
+	}
+
+	ops := make([]clientv3.Op, 0, len(puts))
+	for _, put := range puts {
+		opts, err := b.leaseOption(ctx, put.TTL)
+		if err != nil {
+			return false, 0, nil, err
+		}
+		ops = append(ops, clientv3.OpPut(put.Path, put.Value, opts...))
+	}
+
+	gets := make([]clientv3.Op, 0, len(compares))
+	for _, cmp := range compares {
+		gets = append(gets, clientv3.OpGet(cmp.Path))
+	}
+
+	resp, err := b.client.Txn(ctx).If(cmps...).Then(ops...).Else(gets...).Commit()
+	if err != nil {
+		return false, 0, nil, err
+	}
+	if resp.Succeeded {
+		return true, uint64(resp.Header.Revision), nil, nil
+	}
+
+	var conflicted []string
+	for i, cmp := range compares {
+		rangeResp := resp.Responses[i].GetResponseRange()
+
+		var currentRevision uint64
+		if len(rangeResp.Kvs) > 0 {
+			currentRevision = uint64(rangeResp.Kvs[0].ModRevision)
+		}
+
+		if currentRevision != cmp.Revision {
+			conflicted = append(conflicted, cmp.Path)
+		}
+	}
+
+	return false, uint64(resp.Header.Revision), conflicted, nil
+}
+
+func (b *v3Backend) Watch(ctx context.Context, path string, waitIndex uint64, recursive bool, receiver chan *Node, stop chan bool) (*Node, error) {
+	opts := []clientv3.OpOption{}
+	if recursive {
+		opts = append(opts, clientv3.WithPrefix())
+	}
+	if waitIndex > 0 {
+		opts = append(opts, clientv3.WithRev(int64(waitIndex)))
+	}
+
+	watchChan := b.client.Watch(ctx, path, opts...)
+
+	for {
+		select {
+		case <-stop:
+			return nil, nil
+
+		case resp, ok := <-watchChan:
+			if !ok {
+				return nil, nil
+			}
+			if err := resp.Err(); err != nil {
+				return nil, err
+			}
+			if resp.CompactRevision != 0 {
+				return nil, compactedErr(path)
+			}
+
+			var last *Node
+			for _, ev := range resp.Events {
+				last = nodeFromEvent(ev)
+
+				select {
+				case receiver <- last:
+				case <-stop:
+					return last, nil
+				}
+			}
+		}
+	}
+}
+
+// leaseOption grants a lease for ttl seconds and returns the OpOption that attaches it to a Put,
+// or no options at all when ttl is zero (an unlimited-lifetime key)
+func (b *v3Backend) leaseOption(ctx context.Context, ttl uint64) ([]clientv3.OpOption, error) {
+	if ttl == 0 {
+		return nil, nil
+	}
+
+	lease, err := b.client.Grant(ctx, int64(ttl))
+	if err != nil {
+		return nil, err
+	}
+
+	return []clientv3.OpOption{clientv3.WithLease(lease.ID)}, nil
+}
+
+// casComparisons builds the Txn guard for a compare-and-swap/compare-and-delete: prevIndex, when
+// set, must match the key's current mod revision, and prevValue, when set, must match its value
+func casComparisons(path, prevValue string, prevIndex uint64) []clientv3.Cmp {
+	var cmps []clientv3.Cmp
+
+	if prevIndex != 0 {
+		cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(path), "=", int64(prevIndex)))
+	}
+	if prevValue != "" {
+		cmps = append(cmps, clientv3.Compare(clientv3.Value(path), "=", prevValue))
+	}
+
+	return cmps
+}
+
+// currentModRevision pulls the mod revision etcd reported for the compared key out of a failed
+// Txn's Else branch, so a caller can report what version it should have had
+func currentModRevision(resp *clientv3.TxnResponse) uint64 {
+	if len(resp.Responses) == 0 {
+		return 0
+	}
+
+	getResp := resp.Responses[0].GetResponseRange()
+	if getResp == nil || len(getResp.Kvs) == 0 {
+		return 0
+	}
+
+	return uint64(getResp.Kvs[0].ModRevision)
+}
+
+// nodeFromEvent converts a clientv3 watch event into a Node, mapping its type to the same Action
+// vocabulary ("set", "create", "delete") used by node.Action elsewhere in the package
+func nodeFromEvent(ev *clientv3.Event) *Node {
+	node := &Node{
+		Key:           string(ev.Kv.Key),
+		Value:         string(ev.Kv.Value),
+		ModifiedIndex: uint64(ev.Kv.ModRevision),
+	}
+
+	switch {
+	case ev.Type == clientv3.EventTypeDelete:
+		node.Action = "delete"
+	case ev.IsCreate():
+		node.Action = "create"
+	default:
+		node.Action = "set"
+	}
+
+	if ev.PrevKv != nil {
+		node.PrevValue = string(ev.PrevKv.Value)
+	}
+
+	return node
+}
+
+// nodeTreeFromKVs rebuilds the directory tree Save/Load/Watch expect from kvs, the flat list of
+// keys sharing the prefix path, creating the intermediate directory Nodes that etcd 3.x's flat
+// keyspace doesn't otherwise represent
+func nodeTreeFromKVs(prefix string, kvs []*mvccpb.KeyValue) *Node {
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	root := &Node{Key: prefix, Dir: true}
+	nodes := map[string]*Node{prefix: root}
+
+	var ensureDir func(path string) *Node
+	ensureDir = func(path string) *Node {
+		if node, ok := nodes[path]; ok {
+			return node
+		}
+
+		parentPath := prefix
+		if idx := strings.LastIndex(path, "/"); idx > len(prefix) {
+			parentPath = path[:idx]
+		}
+
+		parent := ensureDir(parentPath)
+		node := &Node{Key: path, Dir: true}
+		nodes[path] = node
+		parent.Nodes = append(parent.Nodes, node)
+		return node
+	}
+
+	for _, kv := range kvs {
+		key := string(kv.Key)
+
+		parentPath := prefix
+		if idx := strings.LastIndex(key, "/"); idx > len(prefix) {
+			parentPath = key[:idx]
+		}
+
+		parent := ensureDir(parentPath)
+		leaf := &Node{Key: key, Value: string(kv.Value), ModifiedIndex: uint64(kv.ModRevision)}
+		nodes[key] = leaf
+		parent.Nodes = append(parent.Nodes, leaf)
+	}
+
+	return root
+}
+
+func notFoundError(path string) error {
+	return &etcd.EtcdError{ErrorCode: int(etcdErrorCodeKeyNotFound), Cause: path}
+}
+
+func alreadyExistsErr(path string) error {
+	return &etcd.EtcdError{ErrorCode: int(etcdErrorCodeNodeExist), Cause: path}
+}
+
+func testFailedError(path string, currentIndex uint64) error {
+	return &etcd.EtcdError{ErrorCode: int(etcdErrorCodeTestFailed), Cause: path, Index: currentIndex}
+}
+
+func compactedErr(path string) error {
+	return &etcd.EtcdError{ErrorCode: int(etcdErrorCodeEventIndexCleared), Cause: path}
+}
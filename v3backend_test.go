@@ -0,0 +1,496 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// fakeV3Client is a minimal in-memory stand-in for v3Client: a flat keyspace plus just enough of
+// Txn's Compare/Op machinery to drive v3Backend's Save/Load/Watch paths, without dialing a real
+// etcd 3.x cluster. It satisfies v3Client directly, so it plugs into v3Backend the same way
+// clientMock plugs into v2Backend.
+type fakeV3Client struct {
+	mu       sync.Mutex
+	kvs      map[string]*mvccpb.KeyValue
+	revision int64
+	watchers []*fakeV3Watch
+}
+
+type fakeV3Watch struct {
+	ch     chan clientv3.WatchResponse
+	key    string
+	prefix bool
+}
+
+func newFakeV3Client() *fakeV3Client {
+	return &fakeV3Client{kvs: make(map[string]*mvccpb.KeyValue)}
+}
+
+func (f *fakeV3Client) header() *pb.ResponseHeader {
+	return &pb.ResponseHeader{Revision: f.revision}
+}
+
+func (f *fakeV3Client) rangeLocked(key string, prefix bool) []*mvccpb.KeyValue {
+	if !prefix {
+		if kv, ok := f.kvs[key]; ok {
+			return []*mvccpb.KeyValue{kv}
+		}
+		return nil
+	}
+
+	var kvs []*mvccpb.KeyValue
+	for k, v := range f.kvs {
+		if strings.HasPrefix(k, key) {
+			kvs = append(kvs, v)
+		}
+	}
+	return kvs
+}
+
+func (f *fakeV3Client) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	op := clientv3.OpGet(key, opts...)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	kvs := f.rangeLocked(key, len(op.RangeBytes()) > 0)
+	resp := &clientv3.GetResponse{Header: f.header(), Count: int64(len(kvs))}
+	if !op.IsCountOnly() {
+		resp.Kvs = kvs
+	}
+	return resp, nil
+}
+
+func (f *fakeV3Client) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	resp := f.applyOpLocked(clientv3.OpPut(key, val, opts...)).GetResponsePut()
+	return (*clientv3.PutResponse)(resp), nil
+}
+
+func (f *fakeV3Client) Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	resp := f.applyOpLocked(clientv3.OpDelete(key, opts...)).GetResponseDeleteRange()
+	return (*clientv3.DeleteResponse)(resp), nil
+}
+
+func (f *fakeV3Client) Txn(ctx context.Context) clientv3.Txn {
+	return &fakeV3Txn{client: f}
+}
+
+func (f *fakeV3Client) Grant(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	return &clientv3.LeaseGrantResponse{ResponseHeader: &pb.ResponseHeader{}, ID: clientv3.LeaseID(1), TTL: ttl}, nil
+}
+
+func (f *fakeV3Client) KeepAlive(ctx context.Context, id clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	ch := make(chan *clientv3.LeaseKeepAliveResponse)
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+func (f *fakeV3Client) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	op := clientv3.OpGet(key, opts...)
+	w := &fakeV3Watch{ch: make(chan clientv3.WatchResponse), key: key, prefix: len(op.RangeBytes()) > 0}
+
+	f.mu.Lock()
+	f.watchers = append(f.watchers, w)
+	f.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for i, ww := range f.watchers {
+			if ww == w {
+				f.watchers = append(f.watchers[:i], f.watchers[i+1:]...)
+				break
+			}
+		}
+	}()
+
+	return w.ch
+}
+
+// applyOpLocked executes a single Get/Put/Delete Op against the keyspace, assuming f.mu is already
+// held; it is shared by the public Put/Delete methods and by Txn.Commit's Then/Else branches.
+func (f *fakeV3Client) applyOpLocked(op clientv3.Op) *pb.ResponseOp {
+	key := string(op.KeyBytes())
+
+	switch {
+	case op.IsPut():
+		f.revision++
+		createRevision := f.revision
+		if existing, ok := f.kvs[key]; ok {
+			createRevision = existing.CreateRevision
+		}
+		kv := &mvccpb.KeyValue{
+			Key:            []byte(key),
+			Value:          op.ValueBytes(),
+			CreateRevision: createRevision,
+			ModRevision:    f.revision,
+			Version:        1,
+		}
+		f.kvs[key] = kv
+		f.notifyLocked(clientv3.EventTypePut, kv)
+		return &pb.ResponseOp{Response: &pb.ResponseOp_ResponsePut{ResponsePut: &pb.PutResponse{Header: f.header()}}}
+
+	case op.IsDelete():
+		prevKvs := f.rangeLocked(key, len(op.RangeBytes()) > 0)
+		if len(prevKvs) > 0 {
+			f.revision++
+			for _, kv := range prevKvs {
+				delete(f.kvs, string(kv.Key))
+				f.notifyLocked(clientv3.EventTypeDelete, kv)
+			}
+		}
+		return &pb.ResponseOp{Response: &pb.ResponseOp_ResponseDeleteRange{ResponseDeleteRange: &pb.DeleteRangeResponse{
+			Header:  f.header(),
+			Deleted: int64(len(prevKvs)),
+			PrevKvs: prevKvs,
+		}}}
+
+	default: // op.IsGet()
+		kvs := f.rangeLocked(key, len(op.RangeBytes()) > 0)
+		return &pb.ResponseOp{Response: &pb.ResponseOp_ResponseRange{ResponseRange: &pb.RangeResponse{
+			Header: f.header(),
+			Kvs:    kvs,
+			Count:  int64(len(kvs)),
+		}}}
+	}
+}
+
+// notifyLocked delivers ev to every watcher whose key/prefix matches kv, assuming f.mu is already
+// held. Each delivery runs in its own goroutine so a slow or absent reader can't stall the writer
+// holding the lock.
+func (f *fakeV3Client) notifyLocked(evType mvccpb.Event_EventType, kv *mvccpb.KeyValue) {
+	ev := &clientv3.Event{Type: evType, Kv: kv}
+	resp := clientv3.WatchResponse{Header: pb.ResponseHeader{Revision: f.revision}, Events: []*clientv3.Event{ev}}
+
+	for _, w := range f.watchers {
+		key := string(kv.Key)
+		if w.prefix {
+			if !strings.HasPrefix(key, w.key) {
+				continue
+			}
+		} else if key != w.key {
+			continue
+		}
+
+		w := w
+		go func() { w.ch <- resp }()
+	}
+}
+
+// fakeV3Txn is the Txn returned by fakeV3Client.Txn: it just accumulates the If/Then/Else calls
+// until Commit evaluates them against the keyspace.
+type fakeV3Txn struct {
+	client *fakeV3Client
+	cmps   []clientv3.Cmp
+	then   []clientv3.Op
+	els    []clientv3.Op
+}
+
+func (t *fakeV3Txn) If(cs ...clientv3.Cmp) clientv3.Txn {
+	t.cmps = append(t.cmps, cs...)
+	return t
+}
+
+func (t *fakeV3Txn) Then(ops ...clientv3.Op) clientv3.Txn {
+	t.then = append(t.then, ops...)
+	return t
+}
+
+func (t *fakeV3Txn) Else(ops ...clientv3.Op) clientv3.Txn {
+	t.els = append(t.els, ops...)
+	return t
+}
+
+func (t *fakeV3Txn) Commit() (*clientv3.TxnResponse, error) {
+	f := t.client
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	succeeded := true
+	for _, cmp := range t.cmps {
+		if !f.evalCompareLocked(cmp) {
+			succeeded = false
+			break
+		}
+	}
+
+	ops := t.then
+	if !succeeded {
+		ops = t.els
+	}
+
+	responses := make([]*pb.ResponseOp, 0, len(ops))
+	for _, op := range ops {
+		responses = append(responses, f.applyOpLocked(op))
+	}
+
+	return &clientv3.TxnResponse{Header: f.header(), Succeeded: succeeded, Responses: responses}, nil
+}
+
+// evalCompareLocked resolves a single Cmp against the keyspace, assuming f.mu is already held
+func (f *fakeV3Client) evalCompareLocked(cmp clientv3.Cmp) bool {
+	kv, exists := f.kvs[string(cmp.Key)]
+
+	switch target := cmp.TargetUnion.(type) {
+	case *pb.Compare_CreateRevision:
+		var current int64
+		if exists {
+			current = kv.CreateRevision
+		}
+		return compareInt64(current, cmp.Result, target.CreateRevision)
+
+	case *pb.Compare_ModRevision:
+		var current int64
+		if exists {
+			current = kv.ModRevision
+		}
+		return compareInt64(current, cmp.Result, target.ModRevision)
+
+	case *pb.Compare_Version:
+		var current int64
+		if exists {
+			current = kv.Version
+		}
+		return compareInt64(current, cmp.Result, target.Version)
+
+	case *pb.Compare_Value:
+		var current []byte
+		if exists {
+			current = kv.Value
+		}
+		return compareBytes(current, cmp.Result, target.Value)
+
+	default:
+		return false
+	}
+}
+
+func compareInt64(current int64, result pb.Compare_CompareResult, want int64) bool {
+	switch result {
+	case pb.Compare_EQUAL:
+		return current == want
+	case pb.Compare_NOT_EQUAL:
+		return current != want
+	case pb.Compare_GREATER:
+		return current > want
+	case pb.Compare_LESS:
+		return current < want
+	default:
+		return false
+	}
+}
+
+func compareBytes(current []byte, result pb.Compare_CompareResult, want []byte) bool {
+	c := bytes.Compare(current, want)
+	switch result {
+	case pb.Compare_EQUAL:
+		return c == 0
+	case pb.Compare_NOT_EQUAL:
+		return c != 0
+	case pb.Compare_GREATER:
+		return c > 0
+	case pb.Compare_LESS:
+		return c < 0
+	default:
+		return false
+	}
+}
+
+func newV3BackendWithFake() (*v3Backend, *fakeV3Client) {
+	fake := newFakeV3Client()
+	return &v3Backend{client: fake}, fake
+}
+
+func TestV3BackendSetGetDelete(t *testing.T) {
+	b, _ := newV3BackendWithFake()
+	ctx := context.Background()
+
+	if _, err := b.Set(ctx, "/field", "value", 0); err != nil {
+		t.Fatalf("unexpected error setting a key: %s", err)
+	}
+
+	node, err := b.Get(ctx, "/field", false, false)
+	if err != nil {
+		t.Fatalf("unexpected error getting a key: %s", err)
+	}
+	if node.Value != "value" {
+		t.Errorf("expected value %q, found %q", "value", node.Value)
+	}
+
+	if _, err := b.Delete(ctx, "/field", false); err != nil {
+		t.Fatalf("unexpected error deleting a key: %s", err)
+	}
+
+	if _, err := b.Get(ctx, "/field", false, false); !notFound(err) {
+		t.Errorf("expected a not found error after delete, found %v", err)
+	}
+}
+
+func TestV3BackendGetRecursive(t *testing.T) {
+	b, _ := newV3BackendWithFake()
+	ctx := context.Background()
+
+	if _, err := b.Set(ctx, "/parent/a", "1", 0); err != nil {
+		t.Fatalf("unexpected error setting a key: %s", err)
+	}
+	if _, err := b.Set(ctx, "/parent/b", "2", 0); err != nil {
+		t.Fatalf("unexpected error setting a key: %s", err)
+	}
+
+	node, err := b.Get(ctx, "/parent", false, true)
+	if err != nil {
+		t.Fatalf("unexpected error getting a directory: %s", err)
+	}
+	if !node.Dir || len(node.Nodes) != 2 {
+		t.Fatalf("expected a directory with 2 children, found %+v", node)
+	}
+}
+
+func TestV3BackendCreate(t *testing.T) {
+	b, _ := newV3BackendWithFake()
+	ctx := context.Background()
+
+	if _, err := b.Create(ctx, "/field", "value", 0); err != nil {
+		t.Fatalf("unexpected error creating a key: %s", err)
+	}
+
+	if _, err := b.Create(ctx, "/field", "other", 0); err == nil {
+		t.Fatal("expected an error creating a key that already exists")
+	}
+}
+
+func TestV3BackendCreateInOrder(t *testing.T) {
+	b, _ := newV3BackendWithFake()
+	ctx := context.Background()
+
+	seen := make(map[string]bool)
+	for i := 0; i < 5; i++ {
+		node, err := b.CreateInOrder(ctx, "/queue", "value", 0)
+		if err != nil {
+			t.Fatalf("unexpected error creating an in-order key: %s", err)
+		}
+		if seen[node.Key] {
+			t.Fatalf("key %q generated twice", node.Key)
+		}
+		seen[node.Key] = true
+	}
+}
+
+func TestV3BackendCompareAndSwap(t *testing.T) {
+	b, _ := newV3BackendWithFake()
+	ctx := context.Background()
+
+	node, err := b.Set(ctx, "/field", "value", 0)
+	if err != nil {
+		t.Fatalf("unexpected error setting a key: %s", err)
+	}
+
+	if _, err := b.CompareAndSwap(ctx, "/field", "new-value", 0, "", node.ModifiedIndex); err != nil {
+		t.Fatalf("unexpected error swapping a key: %s", err)
+	}
+
+	if _, err := b.CompareAndSwap(ctx, "/field", "other-value", 0, "", node.ModifiedIndex); err == nil {
+		t.Fatal("expected an error swapping against a stale index")
+	}
+}
+
+func TestV3BackendSaveTxn(t *testing.T) {
+	b, _ := newV3BackendWithFake()
+	ctx := context.Background()
+
+	succeeded, _, conflicted, err := b.Txn(ctx,
+		[]txnCompare{{Path: "/field", Revision: 0}},
+		[]txnPut{{Path: "/field", Value: "value"}},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error committing a transaction: %s", err)
+	}
+	if !succeeded {
+		t.Fatalf("expected the transaction to succeed, conflicted on %v", conflicted)
+	}
+
+	node, err := b.Get(ctx, "/field", false, false)
+	if err != nil {
+		t.Fatalf("unexpected error getting a key: %s", err)
+	}
+	if node.Value != "value" {
+		t.Errorf("expected value %q, found %q", "value", node.Value)
+	}
+
+	// guarding on the stale revision 0 now conflicts, since /field was just created above
+	succeeded, _, conflicted, err = b.Txn(ctx,
+		[]txnCompare{{Path: "/field", Revision: 0}},
+		[]txnPut{{Path: "/field", Value: "other"}},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error committing a transaction: %s", err)
+	}
+	if succeeded {
+		t.Fatal("expected the transaction to conflict")
+	}
+	if len(conflicted) != 1 || conflicted[0] != "/field" {
+		t.Errorf("expected conflicted to list /field, found %v", conflicted)
+	}
+}
+
+func TestV3BackendWatch(t *testing.T) {
+	b, _ := newV3BackendWithFake()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	receiver := make(chan *Node)
+	stop := make(chan bool)
+
+	go func() {
+		if _, err := b.Watch(ctx, "/field", 0, false, receiver, stop); err != nil {
+			t.Errorf("unexpected error watching a key: %s", err)
+		}
+	}()
+
+	// give the watch goroutine time to register with the fake before the write happens
+	time.Sleep(10 * time.Millisecond)
+
+	if _, err := b.Set(ctx, "/field", "value", 0); err != nil {
+		t.Fatalf("unexpected error setting a key: %s", err)
+	}
+
+	select {
+	case node := <-receiver:
+		if node.Value != "value" {
+			t.Errorf("expected value %q, found %q", "value", node.Value)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the watch event")
+	}
+
+	close(stop)
+}
+
+func notFound(err error) bool {
+	etcderr, ok := err.(*etcd.EtcdError)
+	return ok && etcderr.ErrorCode == int(etcdErrorCodeKeyNotFound)
+}
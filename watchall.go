@@ -0,0 +1,196 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// WatchAll establishes a single recursive watch rooted at the configuration's top-level key, like
+// Events, but instead of delivering one Event per change it resolves each change to the dotted Go
+// field path it affects (for example "Sub.Field", or just "Sub" for a map entry or slice element
+// under it) and calls cb once per batch of field paths that changed together. It blocks until ctx
+// is canceled, reloading the whole configuration and resuming from the current revision whenever
+// the watched revision was compacted out of etcd's history.
+//
+// Since the backend delivers one change at a time with no explicit marker for "no more changes in
+// this batch", a batch is flushed as soon as the next change carries a different ModifiedIndex
+// than the one being accumulated; this is a best-effort grouping, not a guarantee that every write
+// sharing a single etcd revision is always reported together.
+func (c *Client) WatchAll(ctx context.Context, cb func(changed []string)) error {
+	var afterIndex uint64
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		receiver := make(chan *Node)
+		stop := make(chan bool)
+		errc := make(chan error, 1)
+
+		go func() {
+			_, err := c.backend.Watch(ctx, c.root(), afterIndex, true, receiver, stop)
+			errc <- err
+		}()
+
+		var batch []string
+		var batchIndex uint64
+		var watchErr error
+
+		flush := func() {
+			if len(batch) > 0 {
+				cb(batch)
+				batch = nil
+			}
+		}
+
+	drain:
+		for {
+			select {
+			case node := <-receiver:
+				if node == nil {
+					break drain
+				}
+
+				afterIndex = node.ModifiedIndex + 1
+
+				if batchIndex != 0 && node.ModifiedIndex != batchIndex {
+					flush()
+				}
+				batchIndex = node.ModifiedIndex
+
+				c.mu.Lock()
+				name := c.applyWatchAllEvent(node)
+				c.mu.Unlock()
+
+				if len(name) > 0 {
+					batch = append(batch, name)
+				}
+
+			case watchErr = <-errc:
+				break drain
+
+			case <-ctx.Done():
+				close(stop)
+				return ctx.Err()
+			}
+		}
+
+		flush()
+		close(stop)
+
+		if watchErr == nil {
+			watchErr = <-errc
+		}
+
+		if watchErr != nil {
+			if !compactedError(watchErr) {
+				return watchErr
+			}
+
+			if err := c.Load(ctx); err != nil {
+				return err
+			}
+			afterIndex = 0
+		}
+	}
+}
+
+// applyWatchAllEvent applies node's change to the Go field it maps to, exactly like applyEvent,
+// and returns the dotted Go field path that changed so WatchAll can report it. It must be called
+// with c.mu held
+func (c *Client) applyWatchAllEvent(node *Node) string {
+	if fieldInfo, ok := c.info[node.Key]; ok {
+		setScalar(fieldInfo.field, node.Value)
+		c.info[node.Key] = info{field: fieldInfo.field, version: node.ModifiedIndex}
+		if c.cache != nil {
+			c.cache.set(node.Key, node.ModifiedIndex, fieldInfo.field, node.Value, fieldInfo.codec)
+		}
+		return c.names[node.Key]
+	}
+
+	separator := strings.LastIndex(node.Key, "/")
+	if separator <= 0 {
+		return ""
+	}
+
+	parentPath := node.Key[:separator]
+	key := node.Key[separator+1:]
+
+	parentInfo, ok := c.info[parentPath]
+	if !ok {
+		return ""
+	}
+
+	deleted := node.Action == "delete" || node.Action == "expire"
+
+	switch parentInfo.field.Kind() {
+	case reflect.Map:
+		if deleted {
+			parentInfo.field.SetMapIndex(reflect.ValueOf(key), reflect.Value{})
+		} else {
+			parentInfo.field.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(node.Value))
+		}
+
+	case reflect.Slice:
+		if deleted {
+			if index, err := strconv.Atoi(key); err == nil && index >= 0 && index < parentInfo.field.Len() {
+				parentInfo.field.Set(reflect.AppendSlice(
+					parentInfo.field.Slice(0, index),
+					parentInfo.field.Slice(index+1, parentInfo.field.Len()),
+				))
+			}
+		}
+	}
+
+	if c.cache != nil {
+		c.cache.invalidate(parentPath)
+	}
+
+	return c.names[parentPath]
+}
+
+// buildFieldNames populates c.names, mapping every etcd path tracked in c.info to the dotted
+// chain of Go field names that leads to it (for example "Sub.Field"), so WatchAll can report
+// changes in terms of the configuration struct instead of raw etcd paths
+func (c *Client) buildFieldNames(config reflect.Value, pathPrefix, namePrefix string) {
+	config = config.Elem()
+	if config.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < config.NumField(); i++ {
+		field := config.Field(i)
+		fieldType := config.Type().Field(i)
+
+		path, _ := parseTag(fieldType.Tag.Get("etcd"))
+		if len(path) == 0 {
+			continue
+		}
+		path = pathPrefix + path
+
+		name := fieldType.Name
+		if len(namePrefix) > 0 {
+			name = namePrefix + "." + name
+		}
+		c.names[path] = name
+
+		target := field
+		if target.Kind() == reflect.Ptr {
+			if target.IsNil() {
+				continue
+			}
+			target = target.Elem()
+		}
+
+		if target.Kind() == reflect.Struct {
+			c.buildFieldNames(target.Addr(), path, name)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2014 Rafael Dantas Justo. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package etcetera
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+)
+
+func TestWatchAll(t *testing.T) {
+	config := struct {
+		Field string `etcd:"/field"`
+		Other string `etcd:"/other"`
+	}{}
+
+	mock := NewClientMock()
+	mock.root = &etcd.Node{Dir: true}
+
+	c := Client{
+		backend: newV2Backend(mock),
+		config:  reflect.ValueOf(&config),
+		info:    make(map[string]info),
+		names:   make(map[string]string),
+		codecs:  defaultCodecs(),
+	}
+	c.preload(c.config, "", "")
+	c.buildFieldNames(c.config, "", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	batches := make(chan []string, 10)
+	errc := make(chan error, 1)
+
+	go func() {
+		errc <- c.WatchAll(ctx, func(changed []string) {
+			batches <- changed
+		})
+	}()
+
+	// The first change is only flushed to cb once the second one arrives with a different
+	// ModifiedIndex (see WatchAll's batching comment), so a second, unrelated change is needed to
+	// observe the first batch at all
+	mock.notifyChangeWithAction(etcd.Node{Key: "/field", Value: "changed"}, "set")
+	mock.notifyChangeWithAction(etcd.Node{Key: "/other", Value: "changed too"}, "set")
+
+	select {
+	case changed := <-batches:
+		if !reflect.DeepEqual(changed, []string{"Field"}) {
+			t.Fatalf("expected the batch to report [Field], found %v", changed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a batch")
+	}
+
+	if config.Field != "changed" {
+		t.Errorf("expected Field to be updated to %q, found %q", "changed", config.Field)
+	}
+
+	cancel()
+
+	select {
+	case err := <-errc:
+		if err != context.Canceled {
+			t.Errorf("expected context.Canceled, found %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for WatchAll to return after cancel")
+	}
+}